@@ -0,0 +1,261 @@
+package mendoza
+
+import (
+	"sort"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// ChangeKind describes how a value was changed by a patch.
+type ChangeKind int
+
+const (
+	// A new value was added.
+	ChangeAdded ChangeKind = iota
+	// A value was removed.
+	ChangeRemoved
+	// A value was replaced by a different value.
+	ChangeModified
+	// A value was copied unchanged to a new position and its original position was removed (e.g. a renamed field),
+	// or an element was reordered within its array.
+	ChangeMoved
+	// A value was copied unchanged to a new position (e.g. with OpCopy, OpObjectCopyField or OpArrayAppendSlice)
+	// and its original position was kept.
+	ChangeCopied
+)
+
+func (kind ChangeKind) String() string {
+	switch kind {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	case ChangeMoved:
+		return "moved"
+	case ChangeCopied:
+		return "copied"
+	}
+	return "unknown"
+}
+
+// Change describes a part of a document which was changed by a patch.
+type Change struct {
+	Kind ChangeKind
+	// Path is the path of the value in the resulting document. For ChangeRemoved it's
+	// the path of the removed value in the base document.
+	Path Path
+	// From is the path in the base document of the value which was moved or copied.
+	From Path
+}
+
+// ChangedPaths reports which parts of a document a patch changes. The changes are found by interpreting
+// the operations of the patch against base, so the cost depends on the size of the patch rather than on
+// the size of the document.
+//
+// Only the outermost changed value is reported (e.g. if a field is added its children are not
+// reported), and the parents of a changed value are not reported. Values which the patch keeps in
+// place are not reported at all, while values which the patch copies unchanged to a new position
+// are reported as ChangeCopied or ChangeMoved instead of as modified. Elements which only shift
+// position because other elements were added/removed before them are not reported, while elements
+// which were reordered within their array are reported as ChangeMoved (in addition to any changes
+// inside them). The elements which keep their relative order are chosen so that as few elements as
+// possible are reported as moved.
+//
+// This function uses the default options.
+func ChangedPaths(base interface{}, patch Patch) ([]Change, error) {
+	return DefaultOptions.ChangedPaths(base, patch)
+}
+
+// ChangedPaths reports which parts of a document a patch changes.
+//
+// If the patch can't be applied it returns the same error as TryApplyPatch.
+func (options *Options) ChangedPaths(base interface{}, patch Patch) ([]Change, error) {
+	t, err := options.tracePatch(base, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	r := changeReporter{options: options, removed: map[string]int{}}
+	err = r.report(t.result, Path{}, Path{}, t.root, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.finish(), nil
+}
+
+// changeReporter compares the result of a trace against the base document.
+type changeReporter struct {
+	options *Options
+	changes []Change
+	// removed contains the position of every ChangeRemoved in changes, keyed by the path.
+	removed map[string]int
+}
+
+// report reports the changes of a value at path in the result. basePath is the path of the value in the
+// base document which it replaces (nil if it's a new value).
+func (r *changeReporter) report(node *traceNode, path, basePath Path, baseValue interface{}, baseExists bool) error {
+	inPlace := basePath != nil && equalPath(node.base, basePath)
+
+	switch node.kind {
+	case traceCopy:
+		if !inPlace {
+			r.changes = append(r.changes, Change{Kind: ChangeCopied, Path: path, From: node.base})
+		}
+		return nil
+	case traceObject:
+		if inPlace {
+			baseValue, err := mendoza.Convert(baseValue, r.options.convertFunc)
+			if err != nil {
+				return err
+			}
+			if obj, ok := baseValue.(map[string]interface{}); ok {
+				return r.reportObject(node, path, basePath, obj)
+			}
+		}
+	case traceArray:
+		if inPlace {
+			baseValue, err := mendoza.Convert(baseValue, r.options.convertFunc)
+			if err != nil {
+				return err
+			}
+			if arr, ok := baseValue.([]interface{}); ok {
+				return r.reportArray(node, path, basePath, arr)
+			}
+		}
+	}
+
+	if baseExists {
+		r.changes = append(r.changes, Change{Kind: ChangeModified, Path: path})
+	} else {
+		r.changes = append(r.changes, Change{Kind: ChangeAdded, Path: path})
+	}
+	return nil
+}
+
+func (r *changeReporter) remove(path Path) {
+	r.removed[path.String()] = len(r.changes)
+	r.changes = append(r.changes, Change{Kind: ChangeRemoved, Path: path})
+}
+
+func (r *changeReporter) reportObject(node *traceNode, path, basePath Path, base map[string]interface{}) error {
+	for _, key := range sortedFieldKeys(node.fields, base) {
+		field, ok := node.fields[key]
+		baseValue, baseExists := base[key]
+		if !ok {
+			r.remove(basePath.child(key))
+			continue
+		}
+		err := r.report(field, path.child(key), basePath.child(key), baseValue, baseExists)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *changeReporter) reportArray(node *traceNode, path, basePath Path, base []interface{}) error {
+	// Every element created from an element of the base array is compared against it, even if it has
+	// a different index in the result.
+	matches := make([]int, len(node.items))
+	used := make([]bool, len(base))
+	for idx, item := range node.items {
+		matches[idx] = -1
+		if baseIdx, ok := childIndex(item.base, basePath); ok && baseIdx < len(base) && !used[baseIdx] {
+			matches[idx] = baseIdx
+			used[baseIdx] = true
+		}
+	}
+
+	for baseIdx := range base {
+		if !used[baseIdx] {
+			r.remove(basePath.child(baseIdx))
+		}
+	}
+
+	// Elements which keep their order relative to the others only shift because elements were added or
+	// removed, while the rest of the matched elements were reordered.
+	inOrder := longestIncreasing(matches)
+
+	for idx, item := range node.items {
+		var err error
+		if baseIdx := matches[idx]; baseIdx != -1 {
+			if !inOrder[idx] {
+				r.changes = append(r.changes, Change{Kind: ChangeMoved, Path: path.child(idx), From: basePath.child(baseIdx)})
+			}
+			err = r.report(item, path.child(idx), basePath.child(baseIdx), base[baseIdx], true)
+		} else {
+			err = r.report(item, path.child(idx), nil, nil, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// longestIncreasing returns which of the values (ignoring -1) are part of the longest increasing subsequence.
+func longestIncreasing(values []int) []bool {
+	// tails[n] is the index of the smallest value which ends an increasing subsequence of length n+1,
+	// and prev links every value to the previous value in its subsequence.
+	tails := []int{}
+	prev := make([]int, len(values))
+	for idx, value := range values {
+		if value == -1 {
+			continue
+		}
+		n := sort.Search(len(tails), func(i int) bool { return values[tails[i]] >= value })
+		prev[idx] = -1
+		if n > 0 {
+			prev[idx] = tails[n-1]
+		}
+		if n == len(tails) {
+			tails = append(tails, idx)
+		} else {
+			tails[n] = idx
+		}
+	}
+
+	result := make([]bool, len(values))
+	if len(tails) > 0 {
+		for idx := tails[len(tails)-1]; idx != -1; idx = prev[idx] {
+			result[idx] = true
+		}
+	}
+	return result
+}
+
+// finish reports copies of values which were removed (or are inside a removed value) as moved, and
+// returns the changes. The removal of a moved value isn't reported.
+func (r *changeReporter) finish() []Change {
+	moved := map[int]bool{}
+	for idx := range r.changes {
+		change := &r.changes[idx]
+		if change.Kind != ChangeCopied {
+			continue
+		}
+		for end := len(change.From); end > 0; end-- {
+			removedIdx, ok := r.removed[change.From[:end].String()]
+			if !ok {
+				continue
+			}
+			if end == len(change.From) && !moved[removedIdx] {
+				change.Kind = ChangeMoved
+				moved[removedIdx] = true
+			} else if end < len(change.From) {
+				change.Kind = ChangeMoved
+			}
+			break
+		}
+	}
+
+	result := make([]Change, 0, len(r.changes)-len(moved))
+	for idx, change := range r.changes {
+		if !moved[idx] {
+			result = append(result, change)
+		}
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package mendoza_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedPaths(t *testing.T) {
+	left := map[string]interface{}{
+		"name":    "Michael Bluth",
+		"age":     35.0,
+		"bio":     "abcdefghijklmnopqrstuvwxyz",
+		"address": map[string]interface{}{"street": "1 Model Home", "zip": 92660.0},
+		"skills":  []interface{}{"business", "banana stand", "dancing", "lying"},
+	}
+	right := map[string]interface{}{
+		"fullName": "Michael Bluth",
+		"bio":      "abcdefghijklmnopqrstuvwxyz",
+		"summary":  "abcdefghijklmnopqrstuvwxyz",
+		"address":  map[string]interface{}{"street": "1 Model Home", "zip": 92661.0},
+		"skills":   []interface{}{"business", "dancing", "magic", "lying"},
+		"son":      "George Michael",
+	}
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	changes, err := mendoza.ChangedPaths(left, patch)
+	require.NoError(t, err)
+
+	require.Equal(t, []mendoza.Change{
+		{Kind: mendoza.ChangeModified, Path: mendoza.Path{"address", "zip"}},
+		{Kind: mendoza.ChangeRemoved, Path: mendoza.Path{"age"}},
+		{Kind: mendoza.ChangeMoved, Path: mendoza.Path{"fullName"}, From: mendoza.Path{"name"}},
+		{Kind: mendoza.ChangeRemoved, Path: mendoza.Path{"skills", 1}},
+		{Kind: mendoza.ChangeAdded, Path: mendoza.Path{"skills", 2}},
+		{Kind: mendoza.ChangeAdded, Path: mendoza.Path{"son"}},
+		{Kind: mendoza.ChangeCopied, Path: mendoza.Path{"summary"}, From: mendoza.Path{"bio"}},
+	}, changes)
+
+	t.Run("Unchanged", func(t *testing.T) {
+		changes, err := mendoza.ChangedPaths(left, mendoza.Patch{})
+		require.NoError(t, err)
+		require.Empty(t, changes)
+	})
+
+	t.Run("RemovedPathsReferToBase", func(t *testing.T) {
+		left := []interface{}{"a", "b", "c", "d", "e"}
+		patch := mendoza.Patch{
+			&mendoza.OpBlank{},
+			&mendoza.OpArrayAppendSlice{Left: 3, Right: 4},
+			&mendoza.OpArrayAppendValue{Value: "f"},
+		}
+
+		changes, err := mendoza.ChangedPaths(left, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeRemoved, Path: mendoza.Path{0}},
+			{Kind: mendoza.ChangeRemoved, Path: mendoza.Path{1}},
+			{Kind: mendoza.ChangeRemoved, Path: mendoza.Path{2}},
+			{Kind: mendoza.ChangeRemoved, Path: mendoza.Path{4}},
+			{Kind: mendoza.ChangeAdded, Path: mendoza.Path{1}},
+		}, changes)
+	})
+
+	t.Run("ReplacedValue", func(t *testing.T) {
+		left := []interface{}{"a", "b", "c", "d"}
+		patch := mendoza.Patch{&mendoza.OpValue{Value: []interface{}{"d"}}}
+
+		changes, err := mendoza.ChangedPaths(left, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeModified, Path: mendoza.Path{}},
+		}, changes)
+	})
+
+	t.Run("CopiedAndModified", func(t *testing.T) {
+		base := map[string]interface{}{
+			"a": map[string]interface{}{"x": 1.0, "y": 2.0},
+		}
+		// Copies a to b and then modifies a.
+		patch := mendoza.Patch{
+			&mendoza.OpPushField{Index: 0},
+			&mendoza.OpCopy{},
+			&mendoza.OpReturnIntoObject{Key: "b"},
+			&mendoza.OpCopy{},
+			&mendoza.OpObjectSetFieldValue{OpValue: mendoza.OpValue{Value: 3.0}, OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "x"}},
+			&mendoza.OpReturnIntoObjectSameKeyPop{},
+		}
+
+		changes, err := mendoza.ChangedPaths(base, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeModified, Path: mendoza.Path{"a", "x"}},
+			{Kind: mendoza.ChangeCopied, Path: mendoza.Path{"b"}, From: mendoza.Path{"a"}},
+		}, changes)
+	})
+
+	t.Run("ValueIsNotCopy", func(t *testing.T) {
+		base := map[string]interface{}{"a": "abc"}
+		// Writes the same value as a instead of copying it.
+		patch := mendoza.Patch{
+			&mendoza.OpObjectSetFieldValue{OpValue: mendoza.OpValue{Value: "abc"}, OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "b"}},
+		}
+
+		changes, err := mendoza.ChangedPaths(base, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeAdded, Path: mendoza.Path{"b"}},
+		}, changes)
+	})
+
+	t.Run("MovedElement", func(t *testing.T) {
+		base := map[string]interface{}{
+			"a": []interface{}{"x", "y"},
+			"b": []interface{}{},
+		}
+		// Moves a[1] to the end of b.
+		patch := mendoza.Patch{
+			&mendoza.OpPushFieldBlank{OpPushField: mendoza.OpPushField{Index: 0}},
+			&mendoza.OpArrayAppendSlice{Left: 0, Right: 1},
+			&mendoza.OpReturnIntoObjectSameKeyPop{},
+			&mendoza.OpPushFieldCopy{OpPushField: mendoza.OpPushField{Index: 1}},
+			&mendoza.OpPushParent{N: 0},
+			&mendoza.OpPushField{Index: 0},
+			&mendoza.OpArrayAppendSlice{Left: 1, Right: 2},
+			&mendoza.OpPop{},
+			&mendoza.OpPop{},
+			&mendoza.OpReturnIntoObjectSameKeyPop{},
+		}
+
+		result, err := mendoza.TryApplyPatch(base, patch)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"a": []interface{}{"x"},
+			"b": []interface{}{"y"},
+		}, result)
+
+		changes, err := mendoza.ChangedPaths(base, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeMoved, Path: mendoza.Path{"b", 0}, From: mendoza.Path{"a", 1}},
+		}, changes)
+	})
+
+	t.Run("Reordered", func(t *testing.T) {
+		base := []interface{}{1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0}
+		reversed := []interface{}{8.0, 7.0, 6.0, 5.0, 4.0, 3.0, 2.0, 1.0}
+		patch, err := mendoza.CreatePatch(base, reversed)
+		require.NoError(t, err)
+
+		changes, err := mendoza.ChangedPaths(base, patch)
+		require.NoError(t, err)
+		expected := []mendoza.Change{}
+		for idx := 0; idx < 7; idx++ {
+			expected = append(expected, mendoza.Change{Kind: mendoza.ChangeMoved, Path: mendoza.Path{idx}, From: mendoza.Path{7 - idx}})
+		}
+		require.Equal(t, expected, changes)
+
+		base = []interface{}{
+			map[string]interface{}{"name": "x"},
+			map[string]interface{}{"name": "y"},
+			map[string]interface{}{"name": "z"},
+		}
+		rotated := []interface{}{base[1], base[2], base[0]}
+		patch, err = mendoza.CreatePatch(base, rotated)
+		require.NoError(t, err)
+
+		changes, err = mendoza.ChangedPaths(base, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeMoved, Path: mendoza.Path{2}, From: mendoza.Path{0}},
+		}, changes)
+
+		// Elements which only shift because of an insertion aren't moved.
+		patch, err = mendoza.CreatePatch(base, []interface{}{base[0], "new", base[1], base[2]})
+		require.NoError(t, err)
+
+		changes, err = mendoza.ChangedPaths(base, patch)
+		require.NoError(t, err)
+		require.Equal(t, []mendoza.Change{
+			{Kind: mendoza.ChangeAdded, Path: mendoza.Path{1}},
+		}, changes)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		_, err := mendoza.ChangedPaths("abc", mendoza.Patch{&mendoza.OpPushField{Index: 0}})
+		var applyErr *mendoza.ApplyError
+		require.True(t, errors.As(err, &applyErr), "expected ApplyError, got %v", err)
+	})
+}
@@ -0,0 +1,249 @@
+package mendoza
+
+import (
+	"sort"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+type changeKind int
+
+const (
+	changeAdd changeKind = iota
+	changeRemove
+	changeReplace
+	changeMove
+	changeCopy
+)
+
+// change is a single step in a description of the difference between two documents. The changes are
+// applied in order, and path and from refer to the document as it looks after the previous changes.
+// leftPath is the path of the removed/replaced/moved/copied value in the left document.
+type change struct {
+	kind     changeKind
+	path     Path
+	from     Path
+	leftPath Path
+	value    interface{}
+}
+
+// findChanges finds the changes which turns the left document into the right document.
+func (options *Options) findChanges(left, right interface{}) ([]change, error) {
+	leftList, err := mendoza.HashListFor(left, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	rightList, err := mendoza.HashListFor(right, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	finder := changeFinder{left: leftList, right: rightList, options: options}
+	finder.diff(Path{}, Path{}, 0, 0)
+	return finder.changes, nil
+}
+
+type changeFinder struct {
+	left    *mendoza.HashList
+	right   *mendoza.HashList
+	options *Options
+	changes []change
+}
+
+func (f *changeFinder) add(kind changeKind, path, from, leftPath Path, rightIdx int) {
+	c := change{kind: kind, path: path, from: from, leftPath: leftPath}
+	if kind == changeAdd || kind == changeReplace {
+		c.value = f.right.Entries[rightIdx].Value
+	}
+	f.changes = append(f.changes, c)
+}
+
+func (f *changeFinder) diff(path, leftPath Path, leftIdx, rightIdx int) {
+	if f.left.Entries[leftIdx].Hash == f.right.Entries[rightIdx].Hash {
+		return
+	}
+
+	switch {
+	case isMapEntry(f.left, leftIdx) && isMapEntry(f.right, rightIdx):
+		f.diffMap(path, leftPath, leftIdx, rightIdx)
+	case isSliceEntry(f.left, leftIdx) && isSliceEntry(f.right, rightIdx):
+		f.diffSlice(path, leftPath, leftIdx, rightIdx)
+	default:
+		f.add(changeReplace, path, nil, leftPath, rightIdx)
+	}
+}
+
+func (f *changeFinder) diffMap(path, leftPath Path, leftIdx, rightIdx int) {
+	leftFields := mapChildren(f.left, leftIdx)
+	rightFields := mapChildren(f.right, rightIdx)
+
+	var removed, added, changed, unchanged []string
+
+	for key, idx := range leftFields {
+		rightIdx, ok := rightFields[key]
+		switch {
+		case !ok:
+			removed = append(removed, key)
+		case f.left.Entries[idx].Hash == f.right.Entries[rightIdx].Hash:
+			unchanged = append(unchanged, key)
+		default:
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range rightFields {
+		if _, ok := leftFields[key]; !ok {
+			added = append(added, key)
+		}
+	}
+
+	sort.Strings(removed)
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(unchanged)
+
+	// Added fields which have the same value as a removed field are moved.
+	moved := map[string]bool{}
+	for _, key := range added {
+		hash := f.right.Entries[rightFields[key]].Hash
+		for _, removedKey := range removed {
+			if !moved[removedKey] && f.left.Entries[leftFields[removedKey]].Hash == hash {
+				moved[removedKey] = true
+				moved[key] = true
+				f.add(changeMove, path.child(key), path.child(removedKey), leftPath.child(removedKey), -1)
+				break
+			}
+		}
+	}
+
+	for _, key := range removed {
+		if !moved[key] {
+			f.add(changeRemove, path.child(key), nil, leftPath.child(key), -1)
+		}
+	}
+
+	for _, key := range changed {
+		f.diff(path.child(key), leftPath.child(key), leftFields[key], rightFields[key])
+	}
+
+	// Added fields which have the same value as an unchanged field are copied.
+	for _, key := range added {
+		if moved[key] {
+			continue
+		}
+
+		rightIdx := rightFields[key]
+		hash := f.right.Entries[rightIdx].Hash
+		kind, from, fromLeft := changeAdd, Path(nil), Path(nil)
+
+		for _, unchangedKey := range unchanged {
+			if f.left.Entries[leftFields[unchangedKey]].Hash == hash {
+				kind, from, fromLeft = changeCopy, path.child(unchangedKey), leftPath.child(unchangedKey)
+				break
+			}
+		}
+
+		f.add(kind, path.child(key), from, fromLeft, rightIdx)
+	}
+}
+
+func (f *changeFinder) diffSlice(path, leftPath Path, leftIdx, rightIdx int) {
+	leftElems := sliceChildren(f.left, leftIdx)
+	rightElems := sliceChildren(f.right, rightIdx)
+
+	edits, ok := myers(len(leftElems), len(rightElems), func(i, j int) bool {
+		return f.left.Entries[leftElems[i]].Hash == f.right.Entries[rightElems[j]].Hash
+	}, maxArrayDiffEdits, nil)
+	if !ok {
+		f.add(changeReplace, path, nil, leftPath, rightIdx)
+		return
+	}
+
+	// pos is the index in the array after the previous changes have been applied.
+	pos := 0
+	var deleted, inserted []int
+
+	flush := func() {
+		// Deleted elements which are replaced by inserted elements are modified in place.
+		n := len(deleted)
+		if len(inserted) < n {
+			n = len(inserted)
+		}
+
+		for i := 0; i < n; i++ {
+			f.diff(path.child(pos), leftPath.child(deleted[i]), leftElems[deleted[i]], rightElems[inserted[i]])
+			pos++
+		}
+
+		for _, idx := range deleted[n:] {
+			f.add(changeRemove, path.child(pos), nil, leftPath.child(idx), -1)
+		}
+
+		for _, idx := range inserted[n:] {
+			f.add(changeAdd, path.child(pos), nil, nil, rightElems[idx])
+			pos++
+		}
+
+		deleted, inserted = nil, nil
+	}
+
+	for _, e := range edits {
+		switch e.kind {
+		case editEqual:
+			flush()
+			pos++
+		case editDelete:
+			deleted = append(deleted, e.left)
+		case editInsert:
+			inserted = append(inserted, e.right)
+		}
+	}
+
+	flush()
+}
+
+// Maximum number of insertions/deletions considered when aligning arrays. Larger changes are
+// treated as a change of the whole array.
+const maxArrayDiffEdits = 1000
+
+func entryValue(list *mendoza.HashList, idx int) interface{} {
+	if idx == -1 {
+		return nil
+	}
+	return list.Entries[idx].Value
+}
+
+func isMapEntry(list *mendoza.HashList, idx int) bool {
+	_, ok := entryValue(list, idx).(map[string]interface{})
+	return ok
+}
+
+func isSliceEntry(list *mendoza.HashList, idx int) bool {
+	_, ok := entryValue(list, idx).([]interface{})
+	return ok
+}
+
+// mapChildren returns the entry index of every field in a map.
+func mapChildren(list *mendoza.HashList, idx int) map[string]int {
+	result := map[string]int{}
+	if idx == -1 || !list.Entries[idx].IsNonEmptyMap() {
+		return result
+	}
+	for it := list.Iter(idx); !it.IsDone(); it.Next() {
+		result[it.GetKey()] = it.GetIndex()
+	}
+	return result
+}
+
+// sliceChildren returns the entry index of every element in a slice.
+func sliceChildren(list *mendoza.HashList, idx int) []int {
+	result := []int{}
+	if idx == -1 || !list.Entries[idx].IsNonEmptySlice() {
+		return result
+	}
+	for it := list.Iter(idx); !it.IsDone(); it.Next() {
+		result = append(result, it.GetIndex())
+	}
+	return result
+}
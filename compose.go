@@ -0,0 +1,32 @@
+package mendoza
+
+// Compose combines a chain of patches into a single patch. Applying the composed patch to
+// base produces the same document as applying each of the patches in order.
+//
+// Operations refer to the document they're applied to (e.g. PushField uses the index of a
+// key), so the patches can't be combined without the document. Instead the patches are
+// applied to base and a new patch is created between base and the final document. The
+// composed patch is therefore never larger than the patch CreatePatch would produce.
+//
+// This function uses the default options.
+func Compose(base interface{}, patches ...Patch) (Patch, error) {
+	return DefaultOptions.Compose(base, patches...)
+}
+
+// Compose combines a chain of patches into a single patch. Applying the composed patch to
+// base produces the same document as applying each of the patches in order.
+//
+// If any of the patches can't be applied it returns the error from TryApplyPatch.
+func (options *Options) Compose(base interface{}, patches ...Patch) (Patch, error) {
+	doc := base
+
+	for _, patch := range patches {
+		var err error
+		doc, err = options.TryApplyPatch(doc, patch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options.CreatePatch(base, doc)
+}
@@ -0,0 +1,55 @@
+package mendoza_test
+
+import (
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompose(t *testing.T) {
+	docs := []interface{}{
+		map[string]interface{}{"name": "Michael", "age": 35.0},
+		map[string]interface{}{"name": "Michael Bluth", "age": 35.0},
+		map[string]interface{}{"name": "Michael Bluth", "age": 36.0, "job": "President"},
+		map[string]interface{}{"name": "Michael Bluth", "job": "President"},
+	}
+
+	patches := []mendoza.Patch{}
+	for i := 1; i < len(docs); i++ {
+		patch, err := mendoza.CreatePatch(docs[i-1], docs[i])
+		require.NoError(t, err)
+		patches = append(patches, patch)
+	}
+
+	t.Run("Chain", func(t *testing.T) {
+		composed, err := mendoza.Compose(docs[0], patches...)
+		require.NoError(t, err)
+		require.Equal(t, docs[3], mendoza.ApplyPatch(docs[0], composed))
+
+		direct, err := mendoza.CreatePatch(docs[0], docs[3])
+		require.NoError(t, err)
+		require.Equal(t, direct, composed)
+	})
+
+	t.Run("Two", func(t *testing.T) {
+		composed, err := mendoza.Compose(docs[1], patches[1], patches[2])
+		require.NoError(t, err)
+		require.Equal(t, docs[3], mendoza.ApplyPatch(docs[1], composed))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		composed, err := mendoza.Compose(docs[0])
+		require.NoError(t, err)
+		require.Empty(t, composed)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		opts := mendoza.DefaultOptions.WithBaseFingerprint(true)
+		patch, err := opts.CreatePatch(docs[1], docs[2])
+		require.NoError(t, err)
+
+		_, err = opts.Compose(docs[0], patch)
+		require.Equal(t, mendoza.ErrBaseMismatch, err)
+	})
+}
@@ -0,0 +1,83 @@
+package mendoza_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePatchContext(t *testing.T) {
+	var left, right interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "a", "b": [1, 2, {"c": "c"}]}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "b", "b": [1, 2, {"c": "d"}]}`), &right))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	patch, err := mendoza.CreatePatchContext(ctx, left, right)
+	require.NoError(t, err)
+	expected, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, expected, patch)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = mendoza.CreatePatchContext(cancelled, left, right)
+	require.Equal(t, context.Canceled, err)
+
+	opts := mendoza.DefaultOptions.WithFallbackOnCancel(true)
+	patch, err = opts.CreatePatchContext(cancelled, left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, mendoza.Patch{&mendoza.OpValue{Value: right}}, patch)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+}
+
+// countdownContext is cancelled after Err has been called a given number of times.
+type countdownContext struct {
+	context.Context
+	remaining int
+}
+
+func (ctx *countdownContext) Done() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func (ctx *countdownContext) Err() error {
+	if ctx.remaining <= 0 {
+		return context.Canceled
+	}
+	ctx.remaining--
+	return nil
+}
+
+func TestCreatePatchContextStringDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	text := make([]byte, 5000)
+	for i := range text {
+		text[i] = byte('a' + rnd.Intn(26))
+	}
+	changed := append([]byte{}, text...)
+	for i := 0; i < 200; i++ {
+		changed[rnd.Intn(len(changed))] = '-'
+	}
+
+	left := map[string]interface{}{"text": string(text)}
+	right := map[string]interface{}{"text": string(changed)}
+	opts := mendoza.DefaultOptions.WithStringDiff(mendoza.StringDiffChar)
+
+	// The string diff checks for cancellation in every round, not only before/after diffing the string.
+	ctx := &countdownContext{Context: context.Background(), remaining: 50}
+	_, err := opts.CreatePatchContext(ctx, left, right)
+	require.Equal(t, context.Canceled, err)
+
+	ctx = &countdownContext{Context: context.Background(), remaining: 1000000}
+	patch, err := opts.CreatePatchContext(ctx, left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+}
@@ -1,7 +1,9 @@
 package mendoza
 
 import (
+	"context"
 	"github.com/sanity-io/mendoza/internal/mendoza"
+	"time"
 	"unicode/utf8"
 )
 
@@ -10,6 +12,11 @@ type differ struct {
 	right     *mendoza.HashList
 	hashIndex *mendoza.HashIndex
 	options   *Options
+	stats     Stats
+
+	// ctx is only set if it can be cancelled. err is set once it has been cancelled.
+	ctx context.Context
+	err error
 }
 
 // Creates a patch which can be applied to the left document to produce the right document.
@@ -29,44 +36,127 @@ func CreateDoublePatch(left, right interface{}) (Patch, Patch, error) {
 
 // Creates a patch which can be applied to the left document to produce the right document.
 func (options *Options) CreatePatch(left, right interface{}) (Patch, error) {
+	return options.createPatch(context.Background(), left, right, &Stats{})
+}
+
+// CreatePatchContext creates a patch which can be applied to the left document to produce the right document.
+// If the context is cancelled before the patch is complete it returns the context's error,
+// or a patch which replaces the whole document if WithFallbackOnCancel is enabled.
+//
+// This function uses the default options.
+func CreatePatchContext(ctx context.Context, left, right interface{}) (Patch, error) {
+	return DefaultOptions.CreatePatchContext(ctx, left, right)
+}
+
+// CreatePatchContext creates a patch which can be applied to the left document to produce the right document.
+// If the context is cancelled before the patch is complete it returns the context's error,
+// or a patch which replaces the whole document if WithFallbackOnCancel is enabled.
+func (options *Options) CreatePatchContext(ctx context.Context, left, right interface{}) (Patch, error) {
+	return options.createPatch(ctx, left, right, &Stats{})
+}
+
+func (options *Options) createPatch(ctx context.Context, left, right interface{}, stats *Stats) (Patch, error) {
 	if left == nil {
 		if right == nil {
-			return Patch{}, nil
+			return options.withBaseFingerprint(mendoza.HashNull, Patch{}), nil
 		}
-		return Patch{&OpValue{right}}, nil
+		right, err := mendoza.ConvertDeep(right, options.convertFunc)
+		if err != nil {
+			return nil, err
+		}
+		return options.withBaseFingerprint(mendoza.HashNull, Patch{&OpValue{right}}), nil
 	}
 
-	leftList, err := mendoza.HashListFor(left, options.convertFunc)
+	start := time.Now()
+	leftList, err := mendoza.HashListForContext(ctx, left, options.convertFunc)
 	if err != nil {
-		return nil, err
+		return options.interrupted(ctx, err, nil, right)
 	}
-	rightList, err := mendoza.HashListFor(right, options.convertFunc)
+	stats.HashingTime = time.Since(start)
+
+	start = time.Now()
+	hashIndex := mendoza.NewHashIndex(leftList)
+	stats.IndexingTime = time.Since(start)
+
+	return options.createPatchFrom(ctx, leftList, hashIndex, right, stats)
+}
+
+// createPatchFrom creates a patch from an already hashed and indexed left document.
+// The time spent on that should already be recorded in stats.
+func (options *Options) createPatchFrom(ctx context.Context, leftList *mendoza.HashList, hashIndex *mendoza.HashIndex, right interface{}, stats *Stats) (Patch, error) {
+	start := time.Now()
+	rightList, err := mendoza.HashListForContext(ctx, right, options.convertFunc)
 	if err != nil {
-		return nil, err
+		return options.interrupted(ctx, err, leftList, right)
 	}
+	hashingTime := stats.HashingTime + time.Since(start)
+	indexingTime := stats.IndexingTime
 
-	hashIndex := mendoza.NewHashIndex(leftList)
 	differ := differ{
 		left:      leftList,
 		right:     rightList,
 		hashIndex: hashIndex,
+		options:   options,
 	}
-	return differ.build(), nil
+
+	if ctx.Done() != nil {
+		differ.ctx = ctx
+	}
+
+	start = time.Now()
+	patch := differ.build()
+	if differ.err != nil {
+		return options.interrupted(ctx, differ.err, leftList, right)
+	}
+
+	*stats = differ.stats
+	stats.HashingTime = hashingTime
+	stats.IndexingTime = indexingTime
+	stats.ReconstructionTime = time.Since(start)
+
+	return options.withBaseFingerprint(leftList.Entries[0].Hash, patch), nil
+}
+
+// interrupted is invoked when creating a patch fails. If the failure was caused by the context being cancelled
+// and WithFallbackOnCancel is enabled it returns a patch which replaces the whole document.
+func (options *Options) interrupted(ctx context.Context, err error, leftList *mendoza.HashList, right interface{}) (Patch, error) {
+	if err != ctx.Err() || !options.fallbackOnCancel {
+		return nil, err
+	}
+
+	right, convertErr := mendoza.ConvertDeep(right, options.convertFunc)
+	if convertErr != nil {
+		return nil, convertErr
+	}
+
+	if leftList == nil {
+		if options.baseFingerprint {
+			// We can't produce a correct patch without knowing the fingerprint.
+			return nil, err
+		}
+		return Patch{&OpValue{right}}, nil
+	}
+
+	return options.withBaseFingerprint(leftList.Entries[0].Hash, Patch{&OpValue{right}}), nil
 }
 
 // Creates two patches: The first can be applied to the left document to produce the right document,
 // the second can be applied to the right document to produce the left document.
 func (options *Options) CreateDoublePatch(left, right interface{}) (Patch, Patch, error) {
 	if left == nil && right == nil {
-		return Patch{}, Patch{}, nil
+		return options.withBaseFingerprint(mendoza.HashNull, Patch{}), options.withBaseFingerprint(mendoza.HashNull, Patch{}), nil
 	}
 
-	if left == nil {
-		return Patch{&OpValue{right}}, Patch{&OpValue{nil}}, nil
-	}
-
-	if right == nil {
-		return Patch{&OpValue{nil}}, Patch{&OpValue{left}}, nil
+	if left == nil || right == nil {
+		leftPatch, err := options.replaceDocument(left, right)
+		if err != nil {
+			return nil, nil, err
+		}
+		rightPatch, err := options.replaceDocument(right, left)
+		if err != nil {
+			return nil, nil, err
+		}
+		return leftPatch, rightPatch, nil
 	}
 
 	leftList, err := mendoza.HashListFor(left, options.convertFunc)
@@ -93,7 +183,28 @@ func (options *Options) CreateDoublePatch(left, right interface{}) (Patch, Patch
 		hashIndex: rightHashIndex,
 		options:   options,
 	}
-	return leftDiffer.build(), rightDiffer.build(), nil
+	leftPatch := options.withBaseFingerprint(leftList.Entries[0].Hash, leftDiffer.build())
+	rightPatch := options.withBaseFingerprint(rightList.Entries[0].Hash, rightDiffer.build())
+	return leftPatch, rightPatch, nil
+}
+
+// replaceDocument returns a patch which replaces doc with value as a whole.
+func (options *Options) replaceDocument(doc, value interface{}) (Patch, error) {
+	value, err := mendoza.ConvertDeep(value, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := mendoza.HashNull
+	if options.baseFingerprint && doc != nil {
+		hashList, err := mendoza.HashListFor(doc, options.convertFunc)
+		if err != nil {
+			return nil, err
+		}
+		hash = hashList.Entries[0].Hash
+	}
+
+	return options.withBaseFingerprint(hash, Patch{&OpValue{value}}), nil
 }
 
 /*
@@ -130,6 +241,9 @@ For arrays/objects this is done in a few steps:
 func (d *differ) build() Patch {
 	root := d.right.Entries[0]
 
+	d.stats.LeftEntries = len(d.left.Entries)
+	d.stats.RightEntries = len(d.right.Entries)
+
 	if d.left.Entries[0].Hash == root.Hash {
 		// Exact same value
 		return Patch{}
@@ -143,9 +257,10 @@ func (d *differ) build() Patch {
 		},
 	}
 
-	d.reconstruct(0, reqs)
+	d.reconstruct(0, 0, reqs)
 
 	req := reqs[0]
+	d.stats.EstimatedSize = req.size
 
 	if req.patch == nil {
 		return Patch{&OpValue{root.Value}}
@@ -170,20 +285,43 @@ func (req *request) update(patch Patch, size int, outputKey string) {
 	}
 }
 
-func (d *differ) reconstruct(idx int, reqs []request) {
-	if len(reqs) == 0 {
+// cancelled checks whether the context has been cancelled, and records the error if so.
+func (d *differ) cancelled() bool {
+	if d.err != nil {
+		return true
+	}
+	if d.ctx != nil {
+		if err := d.ctx.Err(); err != nil {
+			d.err = err
+			return true
+		}
+	}
+	return false
+}
+
+func (d *differ) reconstruct(idx int, depth int, reqs []request) {
+	if len(reqs) == 0 || d.err != nil {
+		return
+	}
+
+	if d.cancelled() {
+		return
+	}
+
+	if d.options.maxDepth > 0 && depth >= d.options.maxDepth {
+		// Too deep: Leave the requests unresolved so that the value gets replaced.
 		return
 	}
 
 	entry := d.right.Entries[idx]
 
 	if entry.IsNonEmptyMap() {
-		d.reconstructMap(idx, reqs)
+		d.reconstructMap(idx, depth, reqs)
 		return
 	}
 
 	if entry.IsNonEmptySlice() {
-		d.reconstructSlice(idx, reqs)
+		d.reconstructSlice(idx, depth, reqs)
 		return
 	}
 
@@ -315,7 +453,17 @@ func (mc *mapCandidate) RegisterRequest(childIdx int, childRef mendoza.Reference
 	mc.seenKeys[childRef.Key] = struct{}{}
 }
 
-func (d *differ) reconstructMap(idx int, reqs []request) {
+// canExplore returns true if another candidate can be explored for the given request.
+// counts keeps track of how many candidates have been explored per request.
+func (d *differ) canExplore(counts []int, requestIdx int) bool {
+	if d.options.maxCandidates > 0 && counts[requestIdx] >= d.options.maxCandidates {
+		return false
+	}
+	counts[requestIdx]++
+	return true
+}
+
+func (d *differ) reconstructMap(idx int, depth int, reqs []request) {
 	// right-index -> list of requests
 	fieldRequests := [][]request{}
 
@@ -337,12 +485,17 @@ func (d *differ) reconstructMap(idx int, reqs []request) {
 	// Currently we're only looking at primary.
 
 	candidates := make([]mapCandidate, 0, len(reqs))
+	candidateCounts := make([]int, len(reqs))
 
 	for i, req := range reqs {
 		if !d.left.Entries[req.primaryIdx].IsNonEmptyMap() {
 			continue
 		}
 
+		if !d.canExplore(candidateCounts, i) {
+			continue
+		}
+
 		cand := mapCandidate{}
 		cand.init(req.primaryIdx, i)
 		candidates = append(candidates, cand)
@@ -351,7 +504,7 @@ func (d *differ) reconstructMap(idx int, reqs []request) {
 	entry := d.right.Entries[idx]
 
 	// Use the xor-index to find fields that differ a bit
-	for it := d.right.Iter(idx); !it.IsDone(); it.Next() {
+	for it := d.right.Iter(idx); !it.IsDone() && !d.options.disableFuzzyMatching; it.Next() {
 		fieldEntry := it.GetEntry()
 
 		xorHash := entry.XorHash
@@ -361,10 +514,11 @@ func (d *differ) reconstructMap(idx int, reqs []request) {
 			otherEntry := d.left.Entries[otherIdx]
 
 			for i, req := range reqs {
-				if otherEntry.Parent == req.contextIdx && otherIdx != req.primaryIdx {
+				if otherEntry.Parent == req.contextIdx && otherIdx != req.primaryIdx && d.canExplore(candidateCounts, i) {
 					cand := mapCandidate{}
 					cand.init(otherIdx, i)
 					candidates = append(candidates, cand)
+					d.stats.FuzzyMatches++
 				}
 			}
 		}
@@ -381,11 +535,14 @@ func (d *differ) reconstructMap(idx int, reqs []request) {
 				cand := &candidates[candIdx]
 				if cand.contextIdx == otherEntry.Parent {
 					cand.insertAlias(fieldEntry.Reference, otherEntry.Reference, fieldEntry.Size)
+					d.stats.ExactAliases++
 				}
 			}
 		}
 	}
 
+	d.stats.MapCandidates += len(candidates)
+
 	// Now build the requests
 	for _, cand := range candidates {
 		contextIter := d.left.Iter(cand.contextIdx)
@@ -424,7 +581,7 @@ func (d *differ) reconstructMap(idx int, reqs []request) {
 	}
 
 	for it := d.right.Iter(idx); !it.IsDone(); it.Next() {
-		d.reconstruct(it.GetIndex(), fieldRequests[it.GetEntry().Reference.Index])
+		d.reconstruct(it.GetIndex(), depth+1, fieldRequests[it.GetEntry().Reference.Index])
 	}
 
 	for _, cand := range candidates {
@@ -597,17 +754,22 @@ func (sc *sliceCandidate) insertAlias(target mendoza.Reference, source mendoza.R
 	}
 }
 
-func (d *differ) reconstructSlice(idx int, reqs []request) {
+func (d *differ) reconstructSlice(idx int, depth int, reqs []request) {
 	// right-index -> requests
 	elementRequests := [][]request{}
 
 	candidates := make([]sliceCandidate, 0, len(reqs))
+	candidateCounts := make([]int, len(reqs))
 
 	for i, req := range reqs {
 		if !d.left.Entries[req.primaryIdx].IsNonEmptySlice() {
 			continue
 		}
 
+		if !d.canExplore(candidateCounts, i) {
+			continue
+		}
+
 		cand := sliceCandidate{}
 		cand.init(req.primaryIdx, i)
 		candidates = append(candidates, cand)
@@ -624,11 +786,14 @@ func (d *differ) reconstructSlice(idx int, reqs []request) {
 				cand := &candidates[candIdx]
 				if cand.contextIdx == otherEntry.Parent {
 					cand.insertAlias(elementEntry.Reference, otherEntry.Reference, elementEntry.Size)
+					d.stats.ExactAliases++
 				}
 			}
 		}
 	}
 
+	d.stats.SliceCandidates += len(candidates)
+
 	// Now build the requests
 	for _, cand := range candidates {
 		contextIter := d.left.Iter(cand.contextIdx)
@@ -658,7 +823,7 @@ func (d *differ) reconstructSlice(idx int, reqs []request) {
 	}
 
 	for it := d.right.Iter(idx); !it.IsDone(); it.Next() {
-		d.reconstruct(it.GetIndex(), elementRequests[it.GetEntry().Reference.Index])
+		d.reconstruct(it.GetIndex(), depth+1, elementRequests[it.GetEntry().Reference.Index])
 	}
 
 	for _, cand := range candidates {
@@ -761,33 +926,38 @@ func (d *differ) reconstructString(idx int, rightString string, reqs []request)
 			panic("unnecessary reconstruction of string")
 		}
 
-		patch := Patch{}
-		size := 0
-
-		d.enterBlank(&patch, req.primaryIdx)
-		size += 2
+		outputKey := d.left.Entries[req.primaryIdx].Reference.Key
 
-		prefix := commonPrefix(leftString, rightString)
+		patch, size := d.stringPatch(req.primaryIdx, rightString, affixSegments(leftString, rightString))
+		reqs[reqIdx].update(patch, size, outputKey)
 
-		if prefix > 0 {
-			patch = append(patch, &OpStringAppendSlice{0, prefix})
-			size += 3
+		if d.options.stringDiff != StringDiffAffix {
+			segments, ok := tokenSegments(leftString, rightString, d.options.stringDiff, d.cancelled)
+			if ok {
+				patch, size := d.stringPatch(req.primaryIdx, rightString, segments)
+				reqs[reqIdx].update(patch, size, outputKey)
+			}
 		}
+	}
+}
 
-		suffix := commonSuffix(leftString, rightString, prefix)
+func (d *differ) stringPatch(primaryIdx int, rightString string, segments []stringSegment) (Patch, int) {
+	patch := Patch{}
+	size := 0
 
-		mid := rightString[prefix : len(rightString)-suffix]
-		if len(mid) > 0 {
-			patch = append(patch, &OpStringAppendString{mid})
-			size += 1 + len(mid)
-		}
+	d.enterBlank(&patch, primaryIdx)
+	size += 2
 
-		if suffix > 0 {
-			patch = append(patch, &OpStringAppendSlice{len(leftString) - suffix, len(leftString)})
+	for _, seg := range segments {
+		if seg.isSlice {
+			patch = append(patch, &OpStringAppendSlice{seg.start, seg.end})
 			size += 3
+		} else {
+			str := rightString[seg.rightStart:seg.rightEnd]
+			patch = append(patch, &OpStringAppendString{str})
+			size += 1 + len(str)
 		}
-
-		req := &reqs[reqIdx]
-		req.update(patch, size, d.left.Entries[req.primaryIdx].Reference.Key)
 	}
+
+	return patch, size
 }
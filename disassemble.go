@@ -0,0 +1,188 @@
+package mendoza
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Mnemonics for every opcode, matching the names in docs/format.adoc.
+var mnemonics = []string{
+	codeValue:                      "Value",
+	codeCopy:                       "Copy",
+	codeBlank:                      "Blank",
+	codeReturnIntoArray:            "ReturnIntoArray",
+	codeReturnIntoObject:           "ReturnIntoObject",
+	codeReturnIntoObjectSameKey:    "ReturnIntoObjectSameKey",
+	codePushField:                  "PushField",
+	codePushElement:                "PushElement",
+	codePushParent:                 "PushParent",
+	codePop:                        "Pop",
+	codePushFieldCopy:              "PushFieldCopy",
+	codePushFieldBlank:             "PushFieldBlank",
+	codePushElementCopy:            "PushElementCopy",
+	codePushElementBlank:           "PushElementBlank",
+	codeReturnIntoObjectPop:        "ReturnIntoObjectPop",
+	codeReturnIntoObjectSameKeyPop: "ReturnIntoObjectSameKeyPop",
+	codeReturnIntoArrayPop:         "ReturnIntoArrayPop",
+	codeObjectSetFieldValue:        "ObjectSetFieldValue",
+	codeObjectCopyField:            "ObjectCopyField",
+	codeObjectDeleteField:          "ObjectDeleteField",
+	codeArrayAppendValue:           "ArrayAppendValue",
+	codeArrayAppendSlice:           "ArrayAppendSlice",
+	codeStringAppendString:         "StringAppendString",
+	codeStringAppendSlice:          "StringAppendSlice",
+	codeAssertFingerprint:          "AssertFingerprint",
+}
+
+// disassemblyWriter is a Writer which formats an operation as its mnemonic followed by the parameters.
+type disassemblyWriter struct {
+	parts []string
+}
+
+func (w *disassemblyWriter) WriteUint8(v uint8) error {
+	if int(v) < len(mnemonics) {
+		w.parts = append(w.parts, mnemonics[v])
+	} else {
+		w.parts = append(w.parts, fmt.Sprintf("Unknown(%d)", v))
+	}
+	return nil
+}
+
+func (w *disassemblyWriter) WriteUint(v int) error {
+	w.parts = append(w.parts, strconv.Itoa(v))
+	return nil
+}
+
+func (w *disassemblyWriter) WriteString(v string) error {
+	w.parts = append(w.parts, strconv.Quote(v))
+	return nil
+}
+
+func (w *disassemblyWriter) WriteValue(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		w.parts = append(w.parts, fmt.Sprintf("%v", v))
+		return nil
+	}
+	w.parts = append(w.parts, string(data))
+	return nil
+}
+
+// String returns the disassembly of the patch (see Disassemble).
+func (patch Patch) String() string {
+	var buf bytes.Buffer
+	_ = patch.Disassemble(&buf)
+	return buf.String()
+}
+
+// Disassemble writes a human-readable version of the patch to w: One operation per line with its
+// position, mnemonic and parameters. Operations are indented by the depth of the input/output stacks.
+func (patch Patch) Disassemble(w io.Writer) error {
+	return patch.disassemble(w, nil)
+}
+
+// DisassembleWithBase is like Disassemble, but it also applies the patch to a base document and
+// annotates the operations which refer to fields with the name of the field. If the patch
+// fails to apply the error is shown after the operation which failed.
+//
+// This function uses the default options.
+func (patch Patch) DisassembleWithBase(w io.Writer, base interface{}) error {
+	return DefaultOptions.DisassembleWithBase(w, patch, base)
+}
+
+// DisassembleWithBase writes a human-readable version of the patch to w (see Patch.Disassemble),
+// annotated with the field names from applying the patch to a base document.
+func (options *Options) DisassembleWithBase(w io.Writer, patch Patch, base interface{}) error {
+	p, err := options.newPatcher(base)
+	if err != nil {
+		return err
+	}
+	return patch.disassemble(w, p)
+}
+
+func (patch Patch) disassemble(w io.Writer, p *patcher) error {
+	v := validator{input: 1, output: 1}
+
+	for idx, op := range patch {
+		before := depth(v)
+		v.step(op)
+		level := depth(v)
+		if before < level {
+			level = before
+		}
+
+		dw := &disassemblyWriter{}
+		err := WriteTo(dw, op)
+		if err != nil {
+			return err
+		}
+
+		line := fmt.Sprintf("%4d  %s%s", idx, strings.Repeat("  ", level-1), strings.Join(dw.parts, " "))
+
+		if p != nil {
+			key := p.fieldKey(op)
+
+			err := p.step(idx, op)
+			if err != nil {
+				line += fmt.Sprintf("  ; %s", err)
+				p = nil
+			} else if key != "" {
+				line += fmt.Sprintf("  ; %s", key)
+			}
+		}
+
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// depth returns the nesting level used for indentation. It never goes below 1 (even for invalid patches).
+func depth(v validator) int {
+	level := v.input
+	if v.output > level {
+		level = v.output
+	}
+	if level < 1 {
+		level = 1
+	}
+	return level
+}
+
+// fieldKey returns the quoted name of the field which an operation refers to, or "" if it doesn't refer to a field.
+func (patcher *patcher) fieldKey(op Op) string {
+	var index int
+
+	switch op := op.(type) {
+	case *OpPushField:
+		index = op.Index
+	case *OpPushFieldCopy:
+		index = op.Index
+	case *OpPushFieldBlank:
+		index = op.Index
+	case *OpObjectCopyField:
+		index = op.Index
+	case *OpObjectDeleteField:
+		index = op.Index
+	case *OpReturnIntoObjectSameKey, *OpReturnIntoObjectSameKeyPop:
+		if len(patcher.inputStack) < 2 {
+			return ""
+		}
+		return strconv.Quote(patcher.inputEntry().key)
+	default:
+		return ""
+	}
+
+	field, err := patcher.inputEntry().getField(index)
+	if err != nil {
+		return ""
+	}
+	return strconv.Quote(field.key)
+}
@@ -0,0 +1,84 @@
+package mendoza_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisassemble(t *testing.T) {
+	left := map[string]interface{}{
+		"name":   "Michael Bluth",
+		"skills": []interface{}{"business", "banana stand"},
+	}
+
+	patch := mendoza.Patch{
+		&mendoza.OpObjectDeleteField{Index: 0},
+		&mendoza.OpPushFieldBlank{OpPushField: mendoza.OpPushField{Index: 1}},
+		&mendoza.OpArrayAppendSlice{Left: 0, Right: 1},
+		&mendoza.OpArrayAppendValue{Value: "dancing"},
+		&mendoza.OpReturnIntoObjectSameKeyPop{},
+		&mendoza.OpPushFieldCopy{OpPushField: mendoza.OpPushField{Index: 0}},
+		&mendoza.OpReturnIntoObjectPop{OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "fullName"}},
+	}
+
+	t.Run("String", func(t *testing.T) {
+		require.Equal(t, strings.Join([]string{
+			`   0  ObjectDeleteField 0`,
+			`   1  PushFieldBlank 1`,
+			`   2    ArrayAppendSlice 0 1`,
+			`   3    ArrayAppendValue "dancing"`,
+			`   4  ReturnIntoObjectSameKeyPop`,
+			`   5  PushFieldCopy 0`,
+			`   6  ReturnIntoObjectPop "fullName"`,
+			``,
+		}, "\n"), patch.String())
+	})
+
+	t.Run("WithBase", func(t *testing.T) {
+		var sb strings.Builder
+		require.NoError(t, patch.DisassembleWithBase(&sb, left))
+		require.Equal(t, strings.Join([]string{
+			`   0  ObjectDeleteField 0  ; "name"`,
+			`   1  PushFieldBlank 1  ; "skills"`,
+			`   2    ArrayAppendSlice 0 1`,
+			`   3    ArrayAppendValue "dancing"`,
+			`   4  ReturnIntoObjectSameKeyPop  ; "skills"`,
+			`   5  PushFieldCopy 0  ; "name"`,
+			`   6  ReturnIntoObjectPop "fullName"`,
+			``,
+		}, "\n"), sb.String())
+	})
+
+	t.Run("WithOptions", func(t *testing.T) {
+		type wrapped struct{ value interface{} }
+		opts := mendoza.DefaultOptions.WithConvertFunc(func(value interface{}) interface{} {
+			if w, ok := value.(wrapped); ok {
+				return w.value
+			}
+			return value
+		})
+
+		var sb strings.Builder
+		require.NoError(t, opts.DisassembleWithBase(&sb, patch, wrapped{left}))
+		lines := strings.Split(sb.String(), "\n")
+		require.Equal(t, `   0  ObjectDeleteField 0  ; "name"`, lines[0])
+		require.Equal(t, `   1  PushFieldBlank 1  ; "skills"`, lines[1])
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		var sb strings.Builder
+		require.NoError(t, patch.DisassembleWithBase(&sb, map[string]interface{}{"a": "b"}))
+		lines := strings.Split(sb.String(), "\n")
+		require.Contains(t, lines[0], `; "a"`)
+		require.Contains(t, lines[1], "; mendoza: op 1")
+		require.NotContains(t, lines[2], ";")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		invalid := mendoza.Patch{&mendoza.OpPop{}, &mendoza.OpReturnIntoArray{}}
+		require.Equal(t, "   0  Pop\n   1  ReturnIntoArray\n", invalid.String())
+	})
+}
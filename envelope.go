@@ -0,0 +1,212 @@
+package mendoza
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EnvelopeVersion is the version of the patch format produced by this package.
+// Envelopes with any other version are rejected when decoded.
+const EnvelopeVersion = 1
+
+// ErrTargetMismatch is returned when applying an envelope doesn't produce the document described by its
+// target fingerprint.
+var ErrTargetMismatch = errors.New("mendoza: result does not match the target fingerprint of the envelope")
+
+// VersionError is returned when decoding an envelope with a version this package doesn't support.
+type VersionError struct {
+	Version int
+}
+
+func (err *VersionError) Error() string {
+	return fmt.Sprintf("mendoza: unsupported envelope version %d (expected %d)", err.Version, EnvelopeVersion)
+}
+
+// Envelope wraps a patch together with its format version and information about the documents it was
+// created from. The patch itself doesn't contain a version, so an envelope should be used whenever patches
+// are stored or sent to a reader which might use a different version of this package.
+type Envelope struct {
+	// Version is the format version of the patch. This should be EnvelopeVersion.
+	Version int
+	// BaseFingerprint is the fingerprint of the document the patch should be applied to (optional).
+	BaseFingerprint *Fingerprint
+	// TargetFingerprint is the fingerprint of the document the patch produces (optional).
+	TargetFingerprint *Fingerprint
+	// CreatedAt is the time the patch was created (optional).
+	CreatedAt time.Time
+	// Metadata contains arbitrary information about the patch (optional).
+	Metadata map[string]string
+	// Patch is the patch itself.
+	Patch Patch
+}
+
+// CreateEnvelope creates a patch between two documents and wraps it in an envelope with both fingerprints.
+//
+// This function uses the default options.
+func CreateEnvelope(left, right interface{}) (*Envelope, error) {
+	return DefaultOptions.CreateEnvelope(left, right)
+}
+
+// CreateEnvelope creates a patch between two documents and wraps it in an envelope with both fingerprints.
+func (options *Options) CreateEnvelope(left, right interface{}) (*Envelope, error) {
+	patch, err := options.CreatePatch(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := options.FingerprintOf(left)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := options.FingerprintOf(right)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Version:           EnvelopeVersion,
+		BaseFingerprint:   &base,
+		TargetFingerprint: &target,
+		CreatedAt:         time.Now().UTC(),
+		Patch:             patch,
+	}, nil
+}
+
+// ApplyEnvelope applies the patch in an envelope to a document. It returns a *VersionError if the
+// version isn't supported, ErrBaseMismatch if the document doesn't match the base fingerprint and
+// ErrTargetMismatch if the result doesn't match the target fingerprint.
+//
+// This function uses the default options.
+func ApplyEnvelope(root interface{}, env *Envelope) (interface{}, error) {
+	return DefaultOptions.ApplyEnvelope(root, env)
+}
+
+// ApplyEnvelope applies the patch in an envelope to a document, verifying the version and fingerprints.
+func (options *Options) ApplyEnvelope(root interface{}, env *Envelope) (interface{}, error) {
+	if env.Version != EnvelopeVersion {
+		return nil, &VersionError{Version: env.Version}
+	}
+
+	if env.BaseFingerprint != nil {
+		fp, err := options.FingerprintOf(root)
+		if err != nil {
+			return nil, err
+		}
+		if fp != *env.BaseFingerprint {
+			return nil, ErrBaseMismatch
+		}
+	}
+
+	result, err := options.TryApplyPatch(root, env.Patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if env.TargetFingerprint != nil {
+		fp, err := options.FingerprintOf(result)
+		if err != nil {
+			return nil, err
+		}
+		if fp != *env.TargetFingerprint {
+			return nil, ErrTargetMismatch
+		}
+	}
+
+	return result, nil
+}
+
+// jsonEnvelope is the JSON representation of an envelope. The patch is kept as raw JSON
+// so that it's only decoded after the version has been checked.
+type jsonEnvelope struct {
+	Version           int               `json:"version"`
+	BaseFingerprint   string            `json:"baseFingerprint,omitempty"`
+	TargetFingerprint string            `json:"targetFingerprint,omitempty"`
+	CreatedAt         *time.Time        `json:"createdAt,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	Patch             json.RawMessage   `json:"patch"`
+}
+
+func (env Envelope) MarshalJSON() ([]byte, error) {
+	if env.Version != EnvelopeVersion {
+		return nil, &VersionError{Version: env.Version}
+	}
+
+	patch, err := env.Patch.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	result := jsonEnvelope{
+		Version:  env.Version,
+		Metadata: env.Metadata,
+		Patch:    patch,
+	}
+	if env.BaseFingerprint != nil {
+		result.BaseFingerprint = env.BaseFingerprint.String()
+	}
+	if env.TargetFingerprint != nil {
+		result.TargetFingerprint = env.TargetFingerprint.String()
+	}
+	if !env.CreatedAt.IsZero() {
+		result.CreatedAt = &env.CreatedAt
+	}
+
+	return json.Marshal(result)
+}
+
+func (env *Envelope) UnmarshalJSON(data []byte) error {
+	return env.UnmarshalJSONWithOptions(data, DecodeOptions{})
+}
+
+// UnmarshalJSONWithOptions is like UnmarshalJSON, but returns a *LimitError if the patch exceeds any of the limits.
+func (env *Envelope) UnmarshalJSONWithOptions(data []byte, opts DecodeOptions) error {
+	var src jsonEnvelope
+	err := json.Unmarshal(data, &src)
+	if err != nil {
+		return err
+	}
+
+	if src.Version != EnvelopeVersion {
+		return &VersionError{Version: src.Version}
+	}
+
+	if len(src.Patch) == 0 {
+		return errors.New("mendoza: envelope is missing patch")
+	}
+
+	result := Envelope{
+		Version:  src.Version,
+		Metadata: src.Metadata,
+	}
+
+	if src.BaseFingerprint != "" {
+		fp, err := ParseFingerprint(src.BaseFingerprint)
+		if err != nil {
+			return err
+		}
+		result.BaseFingerprint = &fp
+	}
+
+	if src.TargetFingerprint != "" {
+		fp, err := ParseFingerprint(src.TargetFingerprint)
+		if err != nil {
+			return err
+		}
+		result.TargetFingerprint = &fp
+	}
+
+	if src.CreatedAt != nil {
+		result.CreatedAt = *src.CreatedAt
+	}
+
+	err = result.Patch.UnmarshalJSONWithOptions(src.Patch, opts)
+	if err != nil {
+		return err
+	}
+
+	*env = result
+	return nil
+}
@@ -0,0 +1,101 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	var left, right interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "abcdef", "b": [1, 2, 3]}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "abcxyzdef", "b": [3, 1, 2]}`), &right))
+
+	env, err := mendoza.CreateEnvelope(left, right)
+	require.NoError(t, err)
+	require.Equal(t, mendoza.EnvelopeVersion, env.Version)
+	require.False(t, env.CreatedAt.IsZero())
+	env.Metadata = map[string]string{"author": "bob"}
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+
+	var decoded mendoza.Envelope
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, env.Version, decoded.Version)
+	require.Equal(t, env.BaseFingerprint, decoded.BaseFingerprint)
+	require.Equal(t, env.TargetFingerprint, decoded.TargetFingerprint)
+	require.True(t, env.CreatedAt.Equal(decoded.CreatedAt))
+	require.Equal(t, env.Metadata, decoded.Metadata)
+	require.EqualValues(t, env.Patch, decoded.Patch)
+
+	result, err := mendoza.ApplyEnvelope(left, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, right, result)
+
+	_, err = mendoza.ApplyEnvelope(right, &decoded)
+	require.Equal(t, mendoza.ErrBaseMismatch, err)
+}
+
+func TestEnvelopeTargetMismatch(t *testing.T) {
+	other := mendoza.Fingerprint{1}
+	env := &mendoza.Envelope{
+		Version:           mendoza.EnvelopeVersion,
+		TargetFingerprint: &other,
+		Patch:             mendoza.Patch{&mendoza.OpValue{Value: "abc"}},
+	}
+
+	_, err := mendoza.ApplyEnvelope(nil, env)
+	require.Equal(t, mendoza.ErrTargetMismatch, err)
+}
+
+func TestEnvelopeMinimal(t *testing.T) {
+	env := &mendoza.Envelope{Version: mendoza.EnvelopeVersion, Patch: mendoza.Patch{}}
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version": 1, "patch": []}`, string(data))
+
+	var decoded mendoza.Envelope
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *env, decoded)
+	require.Equal(t, time.Time{}, decoded.CreatedAt)
+}
+
+func TestEnvelopeUnknownVersion(t *testing.T) {
+	var env mendoza.Envelope
+
+	// The patch contains an unknown opcode, but the version is checked first.
+	err := json.Unmarshal([]byte(`{"version": 2, "patch": [255]}`), &env)
+	var versionErr *mendoza.VersionError
+	require.True(t, errors.As(err, &versionErr), "expected VersionError, got %v", err)
+	require.Equal(t, 2, versionErr.Version)
+
+	err = json.Unmarshal([]byte(`{"patch": []}`), &env)
+	require.True(t, errors.As(err, &versionErr), "expected VersionError, got %v", err)
+	require.Equal(t, 0, versionErr.Version)
+
+	_, err = json.Marshal(&mendoza.Envelope{Version: 2})
+	require.True(t, errors.As(err, &versionErr), "expected VersionError, got %v", err)
+
+	_, err = mendoza.ApplyEnvelope(nil, &mendoza.Envelope{Version: 2})
+	require.True(t, errors.As(err, &versionErr), "expected VersionError, got %v", err)
+
+	err = json.Unmarshal([]byte(`{"version": 1}`), &env)
+	require.Error(t, err)
+}
+
+func TestEnvelopeWithOptions(t *testing.T) {
+	data := []byte(`{"version": 1, "patch": [0, [[["a"]]]]}`)
+
+	var env mendoza.Envelope
+	require.NoError(t, env.UnmarshalJSONWithOptions(data, mendoza.DecodeOptions{MaxDepth: 3}))
+	require.EqualValues(t, mendoza.Patch{&mendoza.OpValue{Value: []interface{}{[]interface{}{[]interface{}{"a"}}}}}, env.Patch)
+
+	err := env.UnmarshalJSONWithOptions(data, mendoza.DecodeOptions{MaxDepth: 2})
+	requireLimitError(t, err, "MaxDepth")
+}
@@ -0,0 +1,60 @@
+package mendoza
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// ErrBaseMismatch is returned when a patch containing a base fingerprint is applied
+// to a different document than the one it was created from.
+var ErrBaseMismatch = errors.New("mendoza: document does not match the base fingerprint of the patch")
+
+// Fingerprint is a (truncated) SHA-256 hash identifying the contents of a document.
+// Documents that are equal produce the same fingerprint.
+type Fingerprint [16]byte
+
+// FingerprintOf calculates the fingerprint of a document.
+//
+// This function uses the default options.
+func FingerprintOf(doc interface{}) (Fingerprint, error) {
+	return DefaultOptions.FingerprintOf(doc)
+}
+
+// FingerprintOf calculates the fingerprint of a document.
+func (options *Options) FingerprintOf(doc interface{}) (Fingerprint, error) {
+	hashList, err := mendoza.HashListFor(doc, options.convertFunc)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	return Fingerprint(hashList.Entries[0].Hash), nil
+}
+
+// ParseFingerprint parses a fingerprint in the hex format produced by String.
+func ParseFingerprint(s string) (Fingerprint, error) {
+	var fp Fingerprint
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fp, err
+	}
+	if len(b) != len(fp) {
+		return fp, fmt.Errorf("expected fingerprint to be %d bytes", len(fp))
+	}
+	copy(fp[:], b)
+	return fp, nil
+}
+
+// String returns the fingerprint as a hex string.
+func (fp Fingerprint) String() string {
+	return hex.EncodeToString(fp[:])
+}
+
+// withBaseFingerprint prefixes the patch with an OpAssertFingerprint if the option is enabled.
+func (options *Options) withBaseFingerprint(hash mendoza.Hash, patch Patch) Patch {
+	if !options.baseFingerprint {
+		return patch
+	}
+	return append(Patch{&OpAssertFingerprint{Fingerprint(hash)}}, patch...)
+}
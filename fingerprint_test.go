@@ -0,0 +1,134 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseFingerprint(t *testing.T) {
+	opts := mendoza.DefaultOptions.WithBaseFingerprint(true)
+
+	var left, right, other interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "a", "b": [1, 2]}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "b", "b": [1, 2]}`), &right))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "c", "b": [1, 2]}`), &other))
+
+	patch, err := opts.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.IsType(t, &mendoza.OpAssertFingerprint{}, patch[0])
+	require.NoError(t, mendoza.Validate(patch))
+
+	result, err := opts.TryApplyPatch(left, patch)
+	require.NoError(t, err)
+	require.EqualValues(t, right, result)
+
+	_, err = opts.TryApplyPatch(other, patch)
+	require.Equal(t, mendoza.ErrBaseMismatch, err)
+
+	b, err := json.Marshal(patch)
+	require.NoError(t, err)
+	var decoded mendoza.Patch
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.EqualValues(t, patch, decoded)
+
+	fp, err := mendoza.FingerprintOf(left)
+	require.NoError(t, err)
+	parsed, err := mendoza.ParseFingerprint(fp.String())
+	require.NoError(t, err)
+	require.Equal(t, fp, parsed)
+	require.Equal(t, fp, patch[0].(*mendoza.OpAssertFingerprint).Fingerprint)
+}
+
+func TestBaseFingerprintDoublePatchNull(t *testing.T) {
+	doc := map[string]interface{}{"a": "b"}
+
+	patch1, patch2, err := mendoza.CreateDoublePatch(doc, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, mendoza.Patch{&mendoza.OpValue{Value: nil}}, patch1)
+	require.EqualValues(t, mendoza.Patch{&mendoza.OpValue{Value: doc}}, patch2)
+
+	opts := mendoza.DefaultOptions.WithBaseFingerprint(true)
+	patch1, patch2, err = opts.CreateDoublePatch(doc, nil)
+	require.NoError(t, err)
+
+	result, err := opts.TryApplyPatch(doc, patch1)
+	require.NoError(t, err)
+	require.Nil(t, result)
+
+	result, err = opts.TryApplyPatch(nil, patch2)
+	require.NoError(t, err)
+	require.EqualValues(t, doc, result)
+
+	_, err = opts.TryApplyPatch(map[string]interface{}{}, patch1)
+	require.Equal(t, mendoza.ErrBaseMismatch, err)
+}
+
+func TestAssertFingerprintNested(t *testing.T) {
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": {"b": [1, 2, {"c": "d"}]}, "e": "f"}`), &doc))
+
+	fpOf := func(value string) mendoza.Fingerprint {
+		var v interface{}
+		require.NoError(t, json.Unmarshal([]byte(value), &v))
+		fp, err := mendoza.FingerprintOf(v)
+		require.NoError(t, err)
+		return fp
+	}
+
+	patch := mendoza.Patch{
+		&mendoza.OpPushField{Index: 0},
+		&mendoza.OpPushField{Index: 0},
+		&mendoza.OpPushElement{Index: 2},
+		&mendoza.OpAssertFingerprint{Fingerprint: fpOf(`{"c": "d"}`)},
+		&mendoza.OpPushParent{N: 0},
+		&mendoza.OpAssertFingerprint{Fingerprint: fpOf(`[1, 2, {"c": "d"}]`)},
+		&mendoza.OpPop{},
+		&mendoza.OpPop{},
+		&mendoza.OpPop{},
+		&mendoza.OpPop{},
+		&mendoza.OpPushField{Index: 1},
+		&mendoza.OpAssertFingerprint{Fingerprint: fpOf(`"f"`)},
+		&mendoza.OpPop{},
+	}
+	_, err := mendoza.TryApplyPatch(doc, patch)
+	require.NoError(t, err)
+
+	patch[5] = &mendoza.OpAssertFingerprint{Fingerprint: fpOf(`[1, 2]`)}
+	_, err = mendoza.TryApplyPatch(doc, patch)
+	require.Equal(t, mendoza.ErrBaseMismatch, err)
+}
+
+func TestAssertFingerprintHashesOnce(t *testing.T) {
+	type item struct{ n int }
+
+	calls := 0
+	opts := mendoza.DefaultOptions.WithConvertFunc(func(value interface{}) interface{} {
+		if value, ok := value.(item); ok {
+			calls++
+			return float64(value.n)
+		}
+		return value
+	})
+
+	items := []interface{}{}
+	for i := 0; i < 1000; i++ {
+		items = append(items, item{i})
+	}
+	doc := map[string]interface{}{"items": items}
+
+	fp, err := opts.FingerprintOf(items)
+	require.NoError(t, err)
+	calls = 0
+
+	// Repeatedly asserting the fingerprint of a large value must not hash it every time.
+	patch := mendoza.Patch{}
+	for i := 0; i < 100; i++ {
+		patch = append(patch, &mendoza.OpPushField{Index: 0}, &mendoza.OpAssertFingerprint{Fingerprint: fp}, &mendoza.OpPop{})
+	}
+	_, err = opts.TryApplyPatch(doc, patch)
+	require.NoError(t, err)
+	require.Equal(t, len(items), calls)
+}
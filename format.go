@@ -1,9 +1,11 @@
 package mendoza
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
+	"strconv"
 )
 
 // Writer is an interface for writing values. This can be used for supporting a custom serialization format.
@@ -28,6 +30,8 @@ type ValueReader interface {
 
 // Note: This code is intentionally very verbose/repetitive in order to be forward compatible.
 
+const maxInt = int(^uint(0) >> 1)
+
 const (
 	codeValue uint8 = iota
 	codeCopy
@@ -60,6 +64,8 @@ const (
 
 	codeStringAppendString
 	codeStringAppendSlice
+
+	codeAssertFingerprint
 )
 
 // Reads a single operation from a reader.
@@ -119,6 +125,8 @@ func ReadFrom(r Reader) (Op, error) {
 		op = &OpStringAppendString{}
 	case codeStringAppendSlice:
 		op = &OpStringAppendSlice{}
+	case codeAssertFingerprint:
+		op = &OpAssertFingerprint{}
 	default:
 		return nil, fmt.Errorf("unknown opcode: %d", code)
 	}
@@ -183,6 +191,8 @@ func WriteTo(w Writer, op Op) error {
 		code = codeStringAppendString
 	case *OpStringAppendSlice:
 		code = codeStringAppendSlice
+	case *OpAssertFingerprint:
+		code = codeAssertFingerprint
 	}
 
 	err := w.WriteUint8(code)
@@ -259,14 +269,34 @@ func ReadUintFromValueReader(r ValueReader) (int, error) {
 		if intVal < 0 {
 			return 0, fmt.Errorf("expected float64 as positive integer")
 		}
+		// float64(maxInt) is rounded up on 64-bit platforms, so the bound is exclusive.
+		if intVal >= float64(maxInt) {
+			return 0, fmt.Errorf("expected float64 to fit in int")
+		}
 		return int(intVal), nil
 	case int:
 		if val < 0 {
 			return 0, fmt.Errorf("expected int as positive integer")
 		}
 		return val, nil
+	case int64:
+		if val < 0 || val > int64(maxInt) {
+			return 0, fmt.Errorf("expected int64 as positive integer")
+		}
+		return int(val), nil
+	case uint64:
+		if val > uint64(maxInt) {
+			return 0, fmt.Errorf("expected uint64 to fit in int")
+		}
+		return int(val), nil
+	case json.Number:
+		intVal, err := strconv.ParseInt(string(val), 10, 64)
+		if err != nil || intVal < 0 || intVal > int64(maxInt) {
+			return 0, fmt.Errorf("expected number as positive integer")
+		}
+		return int(intVal), nil
 	default:
-		return 0, fmt.Errorf("expected float64 or int")
+		return 0, fmt.Errorf("expected integer")
 	}
 }
 
@@ -545,3 +575,18 @@ func (op *OpStringAppendSlice) writeParams(w Writer) (err error) {
 	err = w.WriteUint(op.Right)
 	return
 }
+
+func (op *OpAssertFingerprint) readParams(r Reader) (err error) {
+	var str string
+	str, err = r.ReadString()
+	if err != nil {
+		return
+	}
+	op.Fingerprint, err = ParseFingerprint(str)
+	return
+}
+
+func (op *OpAssertFingerprint) writeParams(w Writer) (err error) {
+	err = w.WriteString(op.Fingerprint.String())
+	return
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/sanity-io/mendoza"
+	"github.com/sanity-io/mendoza/pkg/mendozabin"
+	"github.com/sanity-io/mendoza/pkg/mendozacbor"
 	"github.com/sanity-io/mendoza/pkg/mendozamsgpack"
 	"reflect"
 	"unicode/utf8"
@@ -42,6 +44,38 @@ func roundtripMsgpack(patch mendoza.Patch) {
 	}
 }
 
+func roundtripBinary(patch mendoza.Patch) {
+	b, err := mendozabin.Marshal(patch)
+	if err != nil {
+		panic(err)
+	}
+
+	decoded, err := mendozabin.Unmarshal(b)
+	if err != nil {
+		panic(err)
+	}
+
+	if !reflect.DeepEqual(patch, decoded) {
+		panic("binary serialization didn't roundtrip")
+	}
+}
+
+func roundtripCBOR(patch mendoza.Patch) {
+	b, err := mendozacbor.Marshal(patch)
+	if err != nil {
+		panic(err)
+	}
+
+	decoded, err := mendozacbor.Unmarshal(b)
+	if err != nil {
+		panic(err)
+	}
+
+	if !reflect.DeepEqual(patch, decoded) {
+		panic("CBOR serialization didn't roundtrip")
+	}
+}
+
 func Fuzz(data []byte) int {
 	if !utf8.Valid(data) {
 		return -1
@@ -65,6 +99,14 @@ func Fuzz(data []byte) int {
 		panic(err)
 	}
 
+	if err := mendoza.Validate(patch1); err != nil {
+		panic(err)
+	}
+
+	if err := mendoza.Validate(patch2); err != nil {
+		panic(err)
+	}
+
 	constructedRight := mendoza.ApplyPatch(left, patch1)
 	if !reflect.DeepEqual(right, constructedRight) {
 		panic("up patch is incorrect")
@@ -79,6 +121,10 @@ func Fuzz(data []byte) int {
 	roundtripJSON(patch2)
 	roundtripMsgpack(patch1)
 	roundtripMsgpack(patch2)
+	roundtripBinary(patch1)
+	roundtripBinary(patch2)
+	roundtripCBOR(patch1)
+	roundtripCBOR(patch2)
 
 	return 0
 }
@@ -0,0 +1,353 @@
+package mendoza
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Convert converts a value into one of the types supported by the differ/patcher.
+//
+// It first applies convertFunc (if present) and then uses reflection to convert structs, pointers and typed
+// maps/slices, following the same rules as encoding/json. Only the value itself is converted: The fields of a
+// converted struct are stored as-is in the resulting map and must be converted when they're visited.
+func Convert(value interface{}, convertFunc func(value interface{}) interface{}) (interface{}, error) {
+	if convertFunc != nil {
+		value = convertFunc(value)
+	}
+
+	if isPlain(value) {
+		return value, nil
+	}
+
+	return convertReflect(reflect.ValueOf(value), false)
+}
+
+// ConvertDeep is like Convert, but also converts all nested values. Maps and slices are only copied
+// if they contain a value which needs to be converted.
+func ConvertDeep(value interface{}, convertFunc func(value interface{}) interface{}) (interface{}, error) {
+	result, _, err := convertDeep(value, convertFunc)
+	return result, err
+}
+
+func convertDeep(value interface{}, convertFunc func(value interface{}) interface{}) (interface{}, bool, error) {
+	converted, err := Convert(value, convertFunc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := !same(value, converted)
+
+	switch obj := converted.(type) {
+	case map[string]interface{}:
+		var result map[string]interface{}
+		for key, item := range obj {
+			item, itemChanged, err := convertDeep(item, convertFunc)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemChanged && result == nil {
+				result = make(map[string]interface{}, len(obj))
+				for k, v := range obj {
+					result[k] = v
+				}
+			}
+			if result != nil {
+				result[key] = item
+			}
+		}
+		if result != nil {
+			return result, true, nil
+		}
+	case []interface{}:
+		var result []interface{}
+		for idx, item := range obj {
+			item, itemChanged, err := convertDeep(item, convertFunc)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemChanged && result == nil {
+				result = make([]interface{}, len(obj))
+				copy(result, obj)
+			}
+			if result != nil {
+				result[idx] = item
+			}
+		}
+		if result != nil {
+			return result, true, nil
+		}
+	}
+
+	return converted, changed, nil
+}
+
+// same returns true if a and b are the identical value (without comparing the contents of maps/slices).
+func same(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		return ok && reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	case []interface{}:
+		b, ok := b.([]interface{})
+		return ok && len(a) == len(b) && reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	}
+
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return false
+	}
+	if ta != nil && !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+func isPlain(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, string, map[string]interface{}, []interface{}, json.Number,
+		float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// convertReflect converts a value using reflection. If deep is set nested values are also converted.
+func convertReflect(v reflect.Value, deep bool) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+
+	if v.CanInterface() {
+		if v.Type().Implements(jsonMarshalerType) {
+			return convertMarshaler(v.Interface().(json.Marshaler))
+		}
+
+		if v.Type().Implements(textMarshalerType) {
+			text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			return string(text), nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return convertReflect(v.Elem(), deep)
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Struct:
+		result := map[string]interface{}{}
+		err := convertStruct(v, deep, result)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := convertKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			result[key], err = convertChild(iter.Value(), deep)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		fallthrough
+	case reflect.Array:
+		result := make([]interface{}, v.Len())
+		for i := range result {
+			var err error
+			result[i], err = convertChild(v.Index(i), deep)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type: %s", v.Type())
+}
+
+func convertChild(v reflect.Value, deep bool) (interface{}, error) {
+	if !deep && v.CanInterface() {
+		return v.Interface(), nil
+	}
+	// Values in unexported embedded structs can't be accessed through Interface(), so we convert them right away.
+	return convertReflect(v, true)
+}
+
+func convertMarshaler(m json.Marshaler) (interface{}, error) {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var result interface{}
+	err = dec.Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func convertKey(key reflect.Value) (string, error) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+
+	if key.Type().Implements(textMarshalerType) {
+		text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+
+	return "", fmt.Errorf("unsupported map key type: %s", key.Type())
+}
+
+// convertStruct stores the fields of a struct in result using the rules of encoding/json: Fields are named by
+// their json tag, "-" and unexported fields are skipped, and fields of embedded structs are promoted
+// (unless the outer struct has a field with the same name).
+func convertStruct(v reflect.Value, deep bool, result map[string]interface{}) error {
+	t := v.Type()
+	embedded := []reflect.Value{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		fieldValue := v.Field(i)
+
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldValue)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if hasOption(opts, "omitempty") && isEmptyValue(fieldValue) {
+			continue
+		}
+
+		value, err := convertChild(fieldValue, deep)
+		if err != nil {
+			return err
+		}
+		result[name] = value
+	}
+
+	for _, fieldValue := range embedded {
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		fields := map[string]interface{}{}
+		err := convertStruct(fieldValue, deep, fields)
+		if err != nil {
+			return err
+		}
+
+		for key, value := range fields {
+			if _, ok := result[key]; !ok {
+				result[key] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasOption(opts string, option string) bool {
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
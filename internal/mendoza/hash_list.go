@@ -1,6 +1,8 @@
 package mendoza
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"sort"
 )
@@ -10,6 +12,7 @@ import (
 type HashList struct {
 	Entries []HashEntry
 	convertFunc func(value interface{}) interface{}
+	ctx context.Context
 }
 
 func HashListFor(doc interface{}, convertFunc func(value interface{}) interface{}) (*HashList, error) {
@@ -21,6 +24,22 @@ func HashListFor(doc interface{}, convertFunc func(value interface{}) interface{
 	return hashList, nil
 }
 
+// HashListForContext is like HashListFor, but stops and returns the context's error if it's cancelled.
+func HashListForContext(ctx context.Context, doc interface{}, convertFunc func(value interface{}) interface{}) (*HashList, error) {
+	hashList := &HashList{convertFunc: convertFunc}
+	if ctx.Done() != nil {
+		hashList.ctx = ctx
+	}
+	err := hashList.AddDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	return hashList, nil
+}
+
+// How often (in number of entries) the context is checked for cancellation.
+const cancelCheckInterval = 1024
+
 type Reference struct {
 	Index int
 	Key   string
@@ -35,8 +54,10 @@ func SliceEntryReference(idx int) Reference {
 }
 
 type HashEntry struct {
-	Hash      Hash
-	XorHash   Hash
+	Hash    Hash
+	XorHash Hash
+	// Value is the value converted into plain types (see ConvertDeep). Maps and slices are only
+	// copied if they contain a value which has been converted.
 	Value     interface{}
 	Size      int
 	Parent    int
@@ -62,10 +83,17 @@ func (hashList *HashList) AddDocument(obj interface{}) error {
 func (hashList *HashList) process(parent int, ref Reference, obj interface{}) (result Hash, size int, err error) {
 	current := len(hashList.Entries)
 
+	if hashList.ctx != nil && current%cancelCheckInterval == 0 {
+		if err := hashList.ctx.Err(); err != nil {
+			return result, size, err
+		}
+	}
+
 	var xorHash Hash
 
-	if hashList.convertFunc != nil {
-		obj = hashList.convertFunc(obj)
+	obj, err = Convert(obj, hashList.convertFunc)
+	if err != nil {
+		return result, size, err
 	}
 
 	hashList.Entries = append(hashList.Entries, HashEntry{
@@ -89,6 +117,45 @@ func (hashList *HashList) process(parent int, ref Reference, obj interface{}) (r
 	case float64:
 		result = HashFloat64(obj)
 		size = 8
+	case float32:
+		result = HashFloat64(float64(obj))
+		size = 8
+	case int:
+		result = HashInt64(int64(obj))
+		size = 8
+	case int8:
+		result = HashInt64(int64(obj))
+		size = 8
+	case int16:
+		result = HashInt64(int64(obj))
+		size = 8
+	case int32:
+		result = HashInt64(int64(obj))
+		size = 8
+	case int64:
+		result = HashInt64(obj)
+		size = 8
+	case uint:
+		result = HashUint64(uint64(obj))
+		size = 8
+	case uint8:
+		result = HashUint64(uint64(obj))
+		size = 8
+	case uint16:
+		result = HashUint64(uint64(obj))
+		size = 8
+	case uint32:
+		result = HashUint64(uint64(obj))
+		size = 8
+	case uint64:
+		result = HashUint64(obj)
+		size = 8
+	case json.Number:
+		result, err = HashNumber(string(obj))
+		if err != nil {
+			return result, size, err
+		}
+		size = len(obj)
 	case string:
 		result = HashString(obj)
 		size = len(obj) + 1
@@ -97,6 +164,7 @@ func (hashList *HashList) process(parent int, ref Reference, obj interface{}) (r
 		keys := sortedKeys(obj)
 
 		prevIdx := -1
+		var plain map[string]interface{}
 
 		for idx, key := range keys {
 			value := obj[key]
@@ -117,6 +185,20 @@ func (hashList *HashList) process(parent int, ref Reference, obj interface{}) (r
 
 			hasher.WriteField(key, valueHash)
 			xorHash.Xor(valueHash)
+
+			if converted := hashList.Entries[entryIdx].Value; !same(value, converted) {
+				if plain == nil {
+					plain = make(map[string]interface{}, len(obj))
+					for k, v := range obj {
+						plain[k] = v
+					}
+				}
+				plain[key] = converted
+			}
+		}
+
+		if plain != nil {
+			hashList.Entries[current].Value = plain
 		}
 
 		result = hasher.Sum()
@@ -124,6 +206,7 @@ func (hashList *HashList) process(parent int, ref Reference, obj interface{}) (r
 		hasher := HasherSlice
 
 		prevIdx := -1
+		var plain []interface{}
 
 		for idx, value := range obj {
 			entryIdx := len(hashList.Entries)
@@ -143,6 +226,18 @@ func (hashList *HashList) process(parent int, ref Reference, obj interface{}) (r
 			prevIdx = entryIdx
 
 			hasher.WriteElement(valueHash)
+
+			if converted := hashList.Entries[entryIdx].Value; !same(value, converted) {
+				if plain == nil {
+					plain = make([]interface{}, len(obj))
+					copy(plain, obj)
+				}
+				plain[idx] = converted
+			}
+		}
+
+		if plain != nil {
+			hashList.Entries[current].Value = plain
 		}
 
 		result = hasher.Sum()
@@ -2,8 +2,10 @@ package mendoza
 
 import (
 	"encoding/binary"
+	"fmt"
 	"github.com/sanity-io/mendoza/internal/sha256"
 	"math"
+	"strconv"
 )
 
 // 64-bit ought to be enough
@@ -46,6 +48,7 @@ const (
 	typeTrue
 	typeFalse
 	typeNull
+	typeNumber
 )
 
 func hasherFor(t byte) Hasher {
@@ -84,6 +87,58 @@ func HashFloat64(f float64) Hash {
 	return h.Sum()
 }
 
+// HashInt64 hashes an integer. Integers which can be represented exactly as a float64
+// have the same hash as the float64, so that equal numbers are equal regardless of type.
+func HashInt64(i int64) Hash {
+	f := float64(i)
+	if f >= -(1<<63) && f < (1<<63) && int64(f) == i {
+		return HashFloat64(f)
+	}
+	d, _ := parseDecimal(strconv.FormatInt(i, 10))
+	return hashDecimal(d)
+}
+
+// HashUint64 hashes an unsigned integer. See HashInt64.
+func HashUint64(u uint64) Hash {
+	f := float64(u)
+	if f < (1<<64) && uint64(f) == u {
+		return HashFloat64(f)
+	}
+	d, _ := parseDecimal(strconv.FormatUint(u, 10))
+	return hashDecimal(d)
+}
+
+// HashNumber hashes a number in its JSON representation (e.g. a json.Number). Numbers are
+// compared by their exact value: They have the same hash as a float64 only if NumberFloat64
+// returns true, and otherwise they're hashed by their canonical decimal representation.
+func HashNumber(s string) (Hash, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return HashInt64(i), nil
+	}
+
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return HashUint64(u), nil
+	}
+
+	d, ok := parseDecimal(s)
+	if !ok {
+		return Hash{}, fmt.Errorf("unsupported number: %s", s)
+	}
+
+	if f, ok := d.float64(s); ok {
+		return HashFloat64(f), nil
+	}
+
+	return hashDecimal(d), nil
+}
+
+// hashDecimal hashes a number which can't be represented as a float64.
+func hashDecimal(d decimal) Hash {
+	h := hasherFor(typeNumber)
+	h.hasher.Write([]byte(d.String()))
+	return h.Sum()
+}
+
 func (h *Hasher) Sum() Hash {
 	return h.hasher.CheckSum()
 }
@@ -0,0 +1,166 @@
+package mendoza
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// maxExponent is the largest exponent accepted in a number. Larger exponents are rejected so that a
+// short number (e.g. 1e999999999999) can't be used to make us allocate a huge amount of memory.
+const maxExponent = 100000000
+
+// decimal is the exact value of a number: digits × 10^exp (negated if neg is set). digits has no leading
+// or trailing zeros, so every value has exactly one representation. Zero is represented as decimal{}.
+type decimal struct {
+	neg    bool
+	digits string
+	exp    int
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parseDecimal parses a number in the JSON syntax (e.g. "-1.5e10").
+func parseDecimal(s string) (decimal, bool) {
+	var d decimal
+	var digits []byte
+	exp := 0
+	i := 0
+
+	if i < len(s) && s[i] == '-' {
+		d.neg = true
+		i++
+	}
+
+	start := i
+	for i < len(s) && isDigit(s[i]) {
+		digits = append(digits, s[i])
+		i++
+	}
+	if i == start {
+		return d, false
+	}
+
+	if i < len(s) && s[i] == '.' {
+		i++
+		start = i
+		for i < len(s) && isDigit(s[i]) {
+			digits = append(digits, s[i])
+			exp--
+			i++
+		}
+		if i == start {
+			return d, false
+		}
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		negExp := false
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			negExp = s[i] == '-'
+			i++
+		}
+		start = i
+		e := 0
+		for i < len(s) && isDigit(s[i]) {
+			e = e*10 + int(s[i]-'0')
+			if e > maxExponent {
+				return d, false
+			}
+			i++
+		}
+		if i == start {
+			return d, false
+		}
+		if negExp {
+			e = -e
+		}
+		exp += e
+	}
+
+	if i != len(s) {
+		return d, false
+	}
+
+	for len(digits) > 0 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+		exp++
+	}
+	if len(digits) == 0 {
+		return decimal{}, true
+	}
+
+	d.digits = string(digits)
+	d.exp = exp
+	return d, true
+}
+
+// String returns the canonical representation of the value.
+func (d decimal) String() string {
+	if d.digits == "" {
+		return "0"
+	}
+	s := d.digits + "e" + strconv.Itoa(d.exp)
+	if d.neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// float64 returns the float64 with the same value as the number s (which has been parsed into d).
+// Integers must be exactly equal to the float64, while other numbers must be the shortest
+// representation of it. This means that "0.1" is the float64 0.1 while "0.1000000000000000000001"
+// isn't, even though both of them are rounded to the same float64.
+func (d decimal) float64(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	var text string
+	if d.exp >= 0 {
+		text = new(big.Float).SetFloat64(f).Text('f', 0)
+	} else {
+		text = strconv.FormatFloat(f, 'e', -1, 64)
+	}
+
+	other, ok := parseDecimal(text)
+	if !ok || other != d {
+		return 0, false
+	}
+	return f, true
+}
+
+// NumberFloat64 returns the float64 which has the same value as a number in the JSON syntax
+// (e.g. a json.Number). It returns false if no float64 has the same value, or if the number is invalid.
+//
+// Numbers are hashed as float64 if (and only if) this returns true.
+func NumberFloat64(s string) (float64, bool) {
+	d, ok := parseDecimal(s)
+	if !ok {
+		return 0, false
+	}
+	return d.float64(s)
+}
+
+// NumberDecimal returns the exact value of a number in the JSON syntax as mantissa × 10^exp.
+// The result is canonical: The mantissa has no trailing zeros (and is zero only for zero).
+func NumberDecimal(s string) (mantissa *big.Int, exp int, ok bool) {
+	d, ok := parseDecimal(s)
+	if !ok {
+		return nil, 0, false
+	}
+	mantissa = new(big.Int)
+	if d.digits != "" {
+		mantissa.SetString(d.digits, 10)
+	}
+	if d.neg {
+		mantissa.Neg(mantissa)
+	}
+	return mantissa, d.exp, true
+}
@@ -0,0 +1,23 @@
+package mendoza
+
+// Invert creates a patch which reverts a patch: Applying it to the result of ApplyPatch(base, patch)
+// produces base again. This is the same patch as the second patch returned by CreateDoublePatch,
+// but it can be computed later from the base document and the forward patch.
+//
+// This function uses the default options.
+func Invert(base interface{}, patch Patch) (Patch, error) {
+	return DefaultOptions.Invert(base, patch)
+}
+
+// Invert creates a patch which reverts a patch: Applying it to the result of ApplyPatch(base, patch)
+// produces base again.
+//
+// If the patch can't be applied to base it returns the error from TryApplyPatch.
+func (options *Options) Invert(base interface{}, patch Patch) (Patch, error) {
+	result, err := options.TryApplyPatch(base, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return options.CreatePatch(result, base)
+}
@@ -0,0 +1,42 @@
+package mendoza_test
+
+import (
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvert(t *testing.T) {
+	left := map[string]interface{}{
+		"name":   "Michael Bluth",
+		"skills": []interface{}{"business", "banana stand"},
+	}
+	right := map[string]interface{}{
+		"name":   "Michael",
+		"skills": []interface{}{"business"},
+		"son":    "George Michael",
+	}
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	inverted, err := mendoza.Invert(left, patch)
+	require.NoError(t, err)
+	require.Equal(t, left, mendoza.ApplyPatch(right, inverted))
+
+	_, reverse, err := mendoza.CreateDoublePatch(left, right)
+	require.NoError(t, err)
+	require.Equal(t, reverse, inverted)
+
+	t.Run("Twice", func(t *testing.T) {
+		reverted, err := mendoza.Invert(right, inverted)
+		require.NoError(t, err)
+		require.Equal(t, right, mendoza.ApplyPatch(left, reverted))
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		_, err := mendoza.Invert("hello", patch)
+		require.Error(t, err)
+	})
+}
@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
 )
 
+// jsonWriter writes a patch as a JSON array. Every value is written to w as soon as it's available.
 type jsonWriter struct {
-	result []byte
-	err    error
+	w       io.Writer
+	started bool
 }
 
 func (w *jsonWriter) WriteUint8(v uint8) error {
@@ -25,30 +28,30 @@ func (w *jsonWriter) WriteString(v string) error {
 }
 
 func (w *jsonWriter) WriteValue(v interface{}) error {
-	w.next()
 	b, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	w.result = append(w.result, b...)
-	return nil
+	_, err = w.w.Write(append(w.next(), b...))
+	return err
 }
 
-func (w *jsonWriter) next() {
-	if len(w.result) == 0 {
-		w.result = append(w.result, '[')
-	} else {
-		w.result = append(w.result, ',')
+func (w *jsonWriter) next() []byte {
+	if !w.started {
+		w.started = true
+		return []byte{'['}
 	}
+	return []byte{','}
 }
 
-func (w *jsonWriter) finalize() []byte {
-	if len(w.result) == 0 {
-		return []byte{'[', ']'}
+func (w *jsonWriter) finalize() error {
+	var err error
+	if !w.started {
+		_, err = w.w.Write([]byte{'[', ']'})
+	} else {
+		_, err = w.w.Write([]byte{']'})
 	}
-
-	w.result = append(w.result, ']')
-	return w.result
+	return err
 }
 
 type jsonReader struct {
@@ -93,7 +96,163 @@ func (r *jsonReader) ReadValue() (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	return val, nil
+	return normalizeNumbers(val), nil
+}
+
+func (r *jsonReader) ReadLimitedString(limits *ValueLimits) (string, error) {
+	val, err := r.ReadLimitedValue(limits)
+	if err != nil {
+		return "", err
+	}
+
+	res, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("expected string")
+	}
+
+	return res, nil
+}
+
+func (r *jsonReader) ReadLimitedValue(limits *ValueLimits) (interface{}, error) {
+	err := r.tryEof()
+	if err != nil {
+		return nil, err
+	}
+	t, err := r.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return r.readLimitedValue(t, limits, 0)
+}
+
+// readLimitedValue reads the value which starts with the token t. Unlike Decode it walks the tokens one
+// by one so that the limits are checked before the contents of an array/object are read. Strings can only
+// be checked after the decoder has read them.
+func (r *jsonReader) readLimitedValue(t json.Token, limits *ValueLimits, depth int) (interface{}, error) {
+	switch t := t.(type) {
+	case string:
+		err := limits.String(len(t))
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	case json.Number:
+		return jsonNumber(t), nil
+	case json.Delim:
+		err := limits.Nested(depth)
+		if err != nil {
+			return nil, err
+		}
+
+		var result interface{}
+		if t == '[' {
+			result, err = r.readLimitedArray(limits, depth)
+		} else {
+			result, err = r.readLimitedObject(limits, depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Read the closing delimiter.
+		_, err = r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	return t, nil
+}
+
+func (r *jsonReader) readLimitedArray(limits *ValueLimits, depth int) ([]interface{}, error) {
+	result := []interface{}{}
+	for r.dec.More() {
+		t, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		item, err := r.readLimitedValue(t, limits, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func (r *jsonReader) readLimitedObject(limits *ValueLimits, depth int) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	for r.dec.More() {
+		t, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		// The decoder only returns strings for keys.
+		key := t.(string)
+		err = limits.String(len(key))
+		if err != nil {
+			return nil, err
+		}
+
+		t, err = r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		item, err := r.readLimitedValue(t, limits, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = item
+	}
+	return result, nil
+}
+
+// normalizeNumbers converts numbers decoded with UseNumber (see jsonNumber).
+func normalizeNumbers(val interface{}) interface{} {
+	switch val := val.(type) {
+	case json.Number:
+		return jsonNumber(val)
+	case map[string]interface{}:
+		for key, item := range val {
+			val[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for idx, item := range val {
+			val[idx] = normalizeNumbers(item)
+		}
+	}
+	return val
+}
+
+// jsonNumber converts a number into a float64 (like encoding/json does by default), but only if
+// encoding/json would write the float64 exactly the same way. Any other number (e.g. "1.0", "1e21",
+// large integers or decimals with more precision than a float64) is kept as json.Number so that
+// neither the value nor its representation is lost.
+func jsonNumber(n json.Number) interface{} {
+	s := string(n)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || formatJSONFloat(f) != s {
+		return n
+	}
+	return f
+}
+
+// formatJSONFloat formats a float64 the same way as encoding/json.
+func formatJSONFloat(f float64) string {
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if format == 'e' {
+		// Use e-7 instead of e-07
+		n := len(s)
+		if n >= 4 && s[n-4] == 'e' && s[n-3] == '-' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	}
+	return s
 }
 
 func (r *jsonReader) expectArray() error {
@@ -136,17 +295,30 @@ func (r *jsonValueReader) ReadValue() (interface{}, error) {
 }
 
 func (patch Patch) MarshalJSON() ([]byte, error) {
-	w := jsonWriter{}
+	var buf bytes.Buffer
+	w := jsonWriter{w: &buf}
 	err := patch.WriteTo(&w)
 	if err != nil {
 		return nil, err
 	}
-	return w.finalize(), nil
+	err = w.finalize()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func (patch *Patch) UnmarshalJSON(data []byte) error {
+	return patch.UnmarshalJSONWithOptions(data, DecodeOptions{})
+}
+
+// UnmarshalJSONWithOptions is like UnmarshalJSON, but returns a *LimitError if the patch exceeds any of the limits.
+func (patch *Patch) UnmarshalJSONWithOptions(data []byte, opts DecodeOptions) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
 	r := jsonReader{
-		dec: json.NewDecoder(bytes.NewReader(data)),
+		dec: dec,
 	}
 
 	err := r.expectArray()
@@ -154,11 +326,119 @@ func (patch *Patch) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	return patch.ReadFrom(&r)
+	return patch.ReadFrom(opts.NewReader(&r))
 }
 
 // DecodeJSON decodes a patch from an []interface{} as parsed by encoding/json.
 func (patch *Patch) DecodeJSON(data []interface{}) error {
+	return patch.DecodeJSONWithOptions(data, DecodeOptions{})
+}
+
+// DecodeJSONWithOptions is like DecodeJSON, but returns a *LimitError if the patch exceeds any of the limits.
+func (patch *Patch) DecodeJSONWithOptions(data []interface{}, opts DecodeOptions) error {
 	r := jsonValueReader{data: data}
-	return patch.ReadFrom(&r)
+	return patch.ReadFrom(opts.NewReader(&r))
+}
+
+// Encoder writes a patch in the JSON representation to an io.Writer, one operation at a time.
+// Every value is written as soon as it's encoded, so you might want to wrap the writer in a bufio.Writer.
+type Encoder struct {
+	w jsonWriter
+}
+
+// NewEncoder returns an encoder which writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: jsonWriter{w: w}}
+}
+
+// Encode writes a single operation.
+func (enc *Encoder) Encode(op Op) error {
+	return WriteTo(&enc.w, op)
+}
+
+// Close finishes the patch by writing the end of the JSON array. It doesn't close the underlying writer.
+func (enc *Encoder) Close() error {
+	return enc.w.finalize()
+}
+
+// Decoder reads a patch in the JSON representation from an io.Reader, one operation at a time.
+// Decoder also implements Reader so it can be used with ApplyPatchFromReader.
+//
+// DecodeOptions limits are checked as the values are decoded, but encoding/json reads every string in
+// full before it can be checked. Wrap r in an io.LimitReader to bound the memory used by untrusted input.
+type Decoder struct {
+	r       jsonReader
+	started bool
+	done    bool
+}
+
+// NewDecoder returns a decoder which reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &Decoder{r: jsonReader{dec: dec}}
+}
+
+// Decode reads the next operation. It returns io.EOF when the end of the patch has been reached.
+func (dec *Decoder) Decode() (Op, error) {
+	if dec.done {
+		return nil, io.EOF
+	}
+
+	op, err := ReadFrom(dec)
+	if err == io.EOF {
+		dec.done = true
+	}
+	return op, err
+}
+
+// start reads the beginning of the array before the first value.
+func (dec *Decoder) start() error {
+	if dec.started {
+		return nil
+	}
+	dec.started = true
+	return dec.r.expectArray()
+}
+
+func (dec *Decoder) ReadUint8() (uint8, error) {
+	if err := dec.start(); err != nil {
+		return 0, err
+	}
+	return dec.r.ReadUint8()
+}
+
+func (dec *Decoder) ReadUint() (int, error) {
+	if err := dec.start(); err != nil {
+		return 0, err
+	}
+	return dec.r.ReadUint()
+}
+
+func (dec *Decoder) ReadString() (string, error) {
+	if err := dec.start(); err != nil {
+		return "", err
+	}
+	return dec.r.ReadString()
+}
+
+func (dec *Decoder) ReadValue() (interface{}, error) {
+	if err := dec.start(); err != nil {
+		return nil, err
+	}
+	return dec.r.ReadValue()
+}
+
+func (dec *Decoder) ReadLimitedString(limits *ValueLimits) (string, error) {
+	if err := dec.start(); err != nil {
+		return "", err
+	}
+	return dec.r.ReadLimitedString(limits)
+}
+
+func (dec *Decoder) ReadLimitedValue(limits *ValueLimits) (interface{}, error) {
+	if err := dec.start(); err != nil {
+		return nil, err
+	}
+	return dec.r.ReadLimitedValue(limits)
 }
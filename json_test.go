@@ -0,0 +1,102 @@
+package mendoza_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var streamPatch = mendoza.Patch{
+	&mendoza.OpObjectDeleteField{Index: 0},
+	&mendoza.OpPushFieldBlank{OpPushField: mendoza.OpPushField{Index: 1}},
+	&mendoza.OpArrayAppendSlice{Left: 0, Right: 1},
+	&mendoza.OpArrayAppendValue{Value: map[string]interface{}{"name": "dancing", "level": 2.0}},
+	&mendoza.OpReturnIntoObjectSameKeyPop{},
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := mendoza.NewEncoder(&buf)
+	for _, op := range streamPatch {
+		require.NoError(t, enc.Encode(op))
+	}
+	require.NoError(t, enc.Close())
+
+	expected, err := json.Marshal(streamPatch)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), buf.String())
+
+	t.Run("Empty", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, mendoza.NewEncoder(&buf).Close())
+		require.Equal(t, "[]", buf.String())
+	})
+}
+
+func TestDecoder(t *testing.T) {
+	data, err := json.Marshal(streamPatch)
+	require.NoError(t, err)
+
+	dec := mendoza.NewDecoder(bytes.NewReader(data))
+	patch := mendoza.Patch{}
+	for {
+		op, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		patch = append(patch, op)
+	}
+	require.Equal(t, streamPatch, patch)
+
+	_, err = dec.Decode()
+	require.Equal(t, io.EOF, err)
+
+	t.Run("Truncated", func(t *testing.T) {
+		dec := mendoza.NewDecoder(strings.NewReader(`[19,0,11,1 `))
+		_, err := dec.Decode()
+		require.NoError(t, err)
+		_, err = dec.Decode()
+		require.NoError(t, err)
+		_, err = dec.Decode()
+		require.Error(t, err)
+		require.NotEqual(t, io.EOF, err)
+	})
+
+	t.Run("NotArray", func(t *testing.T) {
+		_, err := mendoza.NewDecoder(strings.NewReader(`{}`)).Decode()
+		require.Error(t, err)
+	})
+}
+
+func TestStreamPipe(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	go func() {
+		enc := mendoza.NewEncoder(pw)
+		for _, op := range streamPatch {
+			assert.NoError(t, enc.Encode(op))
+		}
+		assert.NoError(t, enc.Close())
+		assert.NoError(t, pw.Close())
+	}()
+
+	dec := mendoza.NewDecoder(pr)
+	count := 0
+	for {
+		op, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, streamPatch[count], op)
+		count++
+	}
+	require.Equal(t, len(streamPatch), count)
+}
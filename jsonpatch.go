@@ -0,0 +1,397 @@
+package mendoza
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// JSONPatchOp is a single operation in a JSON Patch (RFC 6902). Path and From are JSON Pointers.
+type JSONPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON encodes the operation with only the members used by its kind. Unlike the default
+// encoding this includes the value for "add", "replace" and "test" even if it's null.
+func (op JSONPatchOp) MarshalJSON() ([]byte, error) {
+	switch op.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			Op    string      `json:"op"`
+			Path  string      `json:"path"`
+			Value interface{} `json:"value"`
+		}{op.Op, op.Path, op.Value})
+	case "move", "copy":
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			From string `json:"from"`
+			Path string `json:"path"`
+		}{op.Op, op.From, op.Path})
+	}
+
+	return json.Marshal(struct {
+		Op   string `json:"op"`
+		Path string `json:"path"`
+	}{op.Op, op.Path})
+}
+
+// ToJSONPatch converts a patch into an equivalent JSON Patch (RFC 6902). The patch is applied to
+// base and the JSON Patch is found by comparing base with the result. Fields which are renamed
+// become "move" operations, and new fields which are equal to an unchanged field become "copy"
+// operations.
+//
+// This function uses the default options.
+func ToJSONPatch(base interface{}, patch Patch) ([]JSONPatchOp, error) {
+	return DefaultOptions.ToJSONPatch(base, patch)
+}
+
+// ToJSONPatch converts a patch into an equivalent JSON Patch (RFC 6902).
+//
+// If the patch can't be applied it returns the error from TryApplyPatch.
+func (options *Options) ToJSONPatch(base interface{}, patch Patch) ([]JSONPatchOp, error) {
+	result, err := options.TryApplyPatch(base, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := options.findChanges(base, result)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]JSONPatchOp, 0, len(changes))
+	for _, c := range changes {
+		op := JSONPatchOp{Path: c.path.String(), Value: c.value}
+		switch c.kind {
+		case changeAdd:
+			op.Op = "add"
+		case changeRemove:
+			op.Op = "remove"
+		case changeReplace:
+			op.Op = "replace"
+		case changeMove:
+			op.Op = "move"
+			op.From = c.from.String()
+		case changeCopy:
+			op.Op = "copy"
+			op.From = c.from.String()
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// JSONPatchError describes a JSON Patch operation which couldn't be applied.
+type JSONPatchError struct {
+	// Index is the position of the offending operation.
+	Index int
+	// Op is the offending operation.
+	Op JSONPatchOp
+	// Reason describes the problem.
+	Reason string
+}
+
+func (err *JSONPatchError) Error() string {
+	return fmt.Sprintf("mendoza: json patch op %d (%s %q): %s", err.Index, err.Op.Op, err.Op.Path, err.Reason)
+}
+
+// FromJSONPatch converts a JSON Patch (RFC 6902) into a patch. The JSON Patch is applied to base
+// and a patch is created between base and the result, so the patch is as compact as one created
+// by CreatePatch. If an operation can't be applied (or a "test" operation fails) it returns a *JSONPatchError.
+//
+// This function uses the default options.
+func FromJSONPatch(base interface{}, ops []JSONPatchOp) (Patch, error) {
+	return DefaultOptions.FromJSONPatch(base, ops)
+}
+
+// FromJSONPatch converts a JSON Patch (RFC 6902) into a patch.
+func (options *Options) FromJSONPatch(base interface{}, ops []JSONPatchOp) (Patch, error) {
+	doc, err := options.plainCopy(base)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, op := range ops {
+		doc, err = options.applyJSONPatchOp(doc, op)
+		if err != nil {
+			if reason, ok := err.(jsonPatchReason); ok {
+				return nil, &JSONPatchError{Index: idx, Op: op, Reason: string(reason)}
+			}
+			return nil, err
+		}
+	}
+
+	return options.CreatePatch(base, doc)
+}
+
+// jsonPatchReason is returned while applying a JSON Patch operation and turned into a *JSONPatchError.
+type jsonPatchReason string
+
+func (reason jsonPatchReason) Error() string {
+	return string(reason)
+}
+
+// plainCopy returns a deep copy of a value using only plain maps/slices, which can then be modified freely.
+func (options *Options) plainCopy(value interface{}) (interface{}, error) {
+	value, err := mendoza.Convert(value, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[key], err = options.plainCopy(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for idx, item := range value {
+			result[idx], err = options.plainCopy(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	return value, nil
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, jsonPatchReason(fmt.Sprintf("invalid JSON Pointer %q", pointer))
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, token := range tokens {
+		tokens[idx] = pointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// arrayIndex parses an array index. If allowEnd is set the index may refer to the end of the array.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, jsonPatchReason(fmt.Sprintf("invalid array index %q", token))
+	}
+
+	if idx > length || (idx == length && !allowEnd) {
+		return 0, jsonPatchReason(fmt.Sprintf("array index %d out of bounds", idx))
+	}
+
+	return idx, nil
+}
+
+// getPointer returns the value at a path.
+func getPointer(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, jsonPatchReason(fmt.Sprintf("missing field %q", token))
+			}
+			doc = value
+		case []interface{}:
+			idx, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[idx]
+		default:
+			return nil, jsonPatchReason(fmt.Sprintf("can't look up %q in %s", token, describe(doc)))
+		}
+	}
+	return doc, nil
+}
+
+// updatePointer finds the container of the value at a path and replaces it with the result of fn.
+// It returns the new document.
+func updatePointer(doc interface{}, tokens []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	child, err := getPointer(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = updatePointer(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		container[tokens[0]] = child
+	case []interface{}:
+		idx, _ := arrayIndex(tokens[0], len(container), false)
+		container[idx] = child
+	}
+
+	return doc, nil
+}
+
+func addPointer(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return updatePointer(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[idx+1:], container[idx:])
+			container[idx] = value
+			return container, nil
+		}
+		return nil, jsonPatchReason(fmt.Sprintf("can't add %q to %s", token, describe(container)))
+	})
+}
+
+func removePointer(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, jsonPatchReason("can't remove the root")
+	}
+
+	return updatePointer(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, jsonPatchReason(fmt.Sprintf("missing field %q", token))
+			}
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:idx], container[idx+1:]...), nil
+		}
+		return nil, jsonPatchReason(fmt.Sprintf("can't remove %q from %s", token, describe(container)))
+	})
+}
+
+func (options *Options) applyJSONPatchOp(doc interface{}, op JSONPatchOp) (interface{}, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := options.plainCopy(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(doc, tokens, value)
+	case "remove":
+		return removePointer(doc, tokens)
+	case "replace":
+		_, err := getPointer(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := options.plainCopy(op.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tokens) == 0 {
+			return value, nil
+		}
+
+		doc, err = removePointer(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(doc, tokens, value)
+	case "move", "copy":
+		fromTokens, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := getPointer(doc, fromTokens)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			value, err = options.plainCopy(value)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, jsonPatchReason("can't move a value into itself")
+			}
+			doc, err = removePointer(doc, fromTokens)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return addPointer(doc, tokens, value)
+	case "test":
+		value, err := getPointer(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		equal, err := options.equalValues(value, op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			return nil, jsonPatchReason("test failed")
+		}
+		return doc, nil
+	}
+
+	return nil, jsonPatchReason(fmt.Sprintf("unknown op %q", op.Op))
+}
+
+// equalValues compares two values by their hashes (e.g. numbers are compared by value).
+func (options *Options) equalValues(a, b interface{}) (bool, error) {
+	aList, err := mendoza.HashListFor(a, options.convertFunc)
+	if err != nil {
+		return false, err
+	}
+	bList, err := mendoza.HashListFor(b, options.convertFunc)
+	if err != nil {
+		return false, err
+	}
+	return aList.Entries[0].Hash == bList.Entries[0].Hash, nil
+}
@@ -0,0 +1,186 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func toJSONPatch(t *testing.T, left, right interface{}) []mendoza.JSONPatchOp {
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	ops, err := mendoza.ToJSONPatch(left, patch)
+	require.NoError(t, err)
+	return ops
+}
+
+func TestToJSONPatch(t *testing.T) {
+	t.Run("Object", func(t *testing.T) {
+		left := map[string]interface{}{
+			"name":    "Michael Bluth",
+			"age":     35.0,
+			"address": map[string]interface{}{"street": "1 Model Home", "zip": 92660.0},
+		}
+		right := map[string]interface{}{
+			"fullName": "Michael Bluth",
+			"address":  map[string]interface{}{"street": "1 Model Home", "zip": 92661.0},
+			"job":      nil,
+		}
+
+		require.Equal(t, []mendoza.JSONPatchOp{
+			{Op: "move", From: "/name", Path: "/fullName"},
+			{Op: "remove", Path: "/age"},
+			{Op: "replace", Path: "/address/zip", Value: 92661.0},
+			{Op: "add", Path: "/job", Value: nil},
+		}, toJSONPatch(t, left, right))
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		left := map[string]interface{}{"a": "abcdefghijklmnopqrstuvwxyz"}
+		right := map[string]interface{}{"a": "abcdefghijklmnopqrstuvwxyz", "b": "abcdefghijklmnopqrstuvwxyz"}
+
+		require.Equal(t, []mendoza.JSONPatchOp{
+			{Op: "copy", From: "/a", Path: "/b"},
+		}, toJSONPatch(t, left, right))
+	})
+
+	t.Run("Array", func(t *testing.T) {
+		left := []interface{}{"a", "b", "c", "d"}
+		right := []interface{}{"a", "c", "x", "d", "e"}
+
+		require.Equal(t, []mendoza.JSONPatchOp{
+			{Op: "remove", Path: "/1"},
+			{Op: "add", Path: "/2", Value: "x"},
+			{Op: "add", Path: "/4", Value: "e"},
+		}, toJSONPatch(t, left, right))
+	})
+
+	t.Run("ArrayElement", func(t *testing.T) {
+		left := []interface{}{map[string]interface{}{"a": 1.0}, "b"}
+		right := []interface{}{map[string]interface{}{"a": 2.0}, "c"}
+
+		require.Equal(t, []mendoza.JSONPatchOp{
+			{Op: "replace", Path: "/0/a", Value: 2.0},
+			{Op: "replace", Path: "/1", Value: "c"},
+		}, toJSONPatch(t, left, right))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		require.Equal(t, []mendoza.JSONPatchOp{
+			{Op: "replace", Path: "", Value: "hello"},
+		}, toJSONPatch(t, 123.0, "hello"))
+		require.Empty(t, toJSONPatch(t, "hello", "hello"))
+	})
+
+	t.Run("Escaping", func(t *testing.T) {
+		left := map[string]interface{}{"a/b": 1.0}
+		right := map[string]interface{}{"a/b": 2.0}
+
+		require.Equal(t, []mendoza.JSONPatchOp{
+			{Op: "replace", Path: "/a~1b", Value: 2.0},
+		}, toJSONPatch(t, left, right))
+	})
+}
+
+func TestJSONPatchOpMarshal(t *testing.T) {
+	data, err := json.Marshal([]mendoza.JSONPatchOp{
+		{Op: "add", Path: "/a", Value: nil},
+		{Op: "remove", Path: "/b"},
+		{Op: "move", From: "/c", Path: "/d"},
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"op": "add", "path": "/a", "value": null},
+		{"op": "remove", "path": "/b"},
+		{"op": "move", "from": "/c", "path": "/d"}
+	]`, string(data))
+}
+
+func fromJSONPatch(t *testing.T, base interface{}, ops string) (interface{}, error) {
+	var jsonOps []mendoza.JSONPatchOp
+	require.NoError(t, json.Unmarshal([]byte(ops), &jsonOps))
+
+	patch, err := mendoza.FromJSONPatch(base, jsonOps)
+	if err != nil {
+		return nil, err
+	}
+	return mendoza.ApplyPatch(base, patch), nil
+}
+
+func TestFromJSONPatch(t *testing.T) {
+	base := map[string]interface{}{
+		"foo": "bar",
+		"baz": []interface{}{"qux", "quux"},
+		"obj": map[string]interface{}{"a": 1.0},
+	}
+
+	t.Run("Operations", func(t *testing.T) {
+		result, err := fromJSONPatch(t, base, `[
+			{"op": "add", "path": "/baz/1", "value": "new"},
+			{"op": "add", "path": "/baz/-", "value": "last"},
+			{"op": "remove", "path": "/baz/0"},
+			{"op": "replace", "path": "/foo", "value": null},
+			{"op": "copy", "from": "/obj", "path": "/copy"},
+			{"op": "add", "path": "/copy/b", "value": 2},
+			{"op": "move", "from": "/obj/a", "path": "/a"},
+			{"op": "test", "path": "/a", "value": 1}
+		]`)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"foo":  nil,
+			"baz":  []interface{}{"new", "quux", "last"},
+			"obj":  map[string]interface{}{},
+			"copy": map[string]interface{}{"a": 1.0, "b": 2.0},
+			"a":    1.0,
+		}, result)
+
+		// The base must not be modified.
+		require.Equal(t, []interface{}{"qux", "quux"}, base["baz"])
+		require.Equal(t, map[string]interface{}{"a": 1.0}, base["obj"])
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		result, err := fromJSONPatch(t, base, `[{"op": "replace", "path": "", "value": [1]}]`)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{1.0}, result)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, ops := range []string{
+			`[{"op": "remove", "path": "/missing"}]`,
+			`[{"op": "replace", "path": "/missing", "value": 1}]`,
+			`[{"op": "add", "path": "/baz/3", "value": 1}]`,
+			`[{"op": "add", "path": "/baz/01", "value": 1}]`,
+			`[{"op": "add", "path": "/foo/bar", "value": 1}]`,
+			`[{"op": "move", "from": "/obj", "path": "/obj/a/b"}]`,
+			`[{"op": "test", "path": "/foo", "value": "baz"}]`,
+			`[{"op": "unknown", "path": "/foo"}]`,
+			`[{"op": "add", "path": "foo", "value": 1}]`,
+		} {
+			_, err := fromJSONPatch(t, base, ops)
+			require.IsType(t, &mendoza.JSONPatchError{}, err, ops)
+		}
+	})
+
+	t.Run("Roundtrip", func(t *testing.T) {
+		right := map[string]interface{}{
+			"foo":    "bar",
+			"baz":    []interface{}{"quux", map[string]interface{}{"a": 1.0}},
+			"object": map[string]interface{}{"a": 2.0},
+			"copy":   "bar",
+		}
+
+		patch, err := mendoza.CreatePatch(base, right)
+		require.NoError(t, err)
+
+		ops, err := mendoza.ToJSONPatch(base, patch)
+		require.NoError(t, err)
+
+		imported, err := mendoza.FromJSONPatch(base, ops)
+		require.NoError(t, err)
+		require.Equal(t, right, mendoza.ApplyPatch(base, imported))
+	})
+}
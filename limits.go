@@ -0,0 +1,216 @@
+package mendoza
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LimitError is returned when a patch exceeds one of the limits in DecodeOptions or ApplyOptions.
+type LimitError struct {
+	// Limit is the name of the limit which was exceeded (e.g. "MaxOps").
+	Limit string
+	// Max is the configured value of the limit.
+	Max int
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("mendoza: patch exceeds limit %s (%d)", err.Limit, err.Max)
+}
+
+// DecodeOptions limits the resources used when decoding untrusted patches. A limit of zero
+// means that there is no limit.
+//
+// The limits are checked as every operation is read. Readers which implement LimitedReader check them
+// while decoding values, while values from other readers are checked after the underlying format has
+// decoded them. The Msgpack reader checks the length of every string before it's allocated. The JSON
+// reader checks nesting before the contents of an array/object are read, but every string has already
+// been read and unescaped by encoding/json when it's checked, so the limits don't bound the memory
+// used by a single large string. Limit the size of the input (e.g. with io.LimitReader) for that.
+type DecodeOptions struct {
+	// MaxOps is the maximum number of operations in the patch.
+	MaxOps int
+	// MaxStringBytes is the maximum number of bytes of all strings in the patch combined. This
+	// includes keys, string parameters and strings (and object keys) inside values.
+	MaxStringBytes int
+	// MaxDepth is the maximum nesting of arrays/objects inside a value (e.g. 1 allows [1, 2] but not [[1]]).
+	MaxDepth int
+	// MaxIndex is the maximum value of any integer parameter (indices, slice bounds and PushParent).
+	MaxIndex int
+}
+
+// ApplyOptions limits the resources used when applying untrusted patches. A limit of zero
+// means that there is no limit. Use Options.WithApplyOptions to enable them.
+type ApplyOptions struct {
+	// MaxOutputSize is the maximum number of array elements, object fields and string bytes
+	// the patcher writes while applying the patch. This includes copying an array/object the first
+	// time it's modified, so it's an approximation of the memory allocated by the patch.
+	MaxOutputSize int
+	// MaxOps is the maximum number of operations in the patch.
+	MaxOps int
+	// MaxDepth is the maximum number of values on the input stack and the output stack (not counting the root).
+	MaxDepth int
+}
+
+// maxValueDepth is the nesting of values which is always rejected by ValueLimits, even if MaxDepth isn't set.
+const maxValueDepth = 10000
+
+var errValueTooDeep = errors.New("mendoza: value is nested too deeply")
+
+// LimitedReader is a Reader which enforces the limits on strings and values while decoding them,
+// so that input which exceeds them is rejected without decoding the rest of the value.
+type LimitedReader interface {
+	Reader
+	// ReadLimitedString is like ReadString, but calls limits.String with the length of the string.
+	ReadLimitedString(limits *ValueLimits) (string, error)
+	// ReadLimitedValue is like ReadValue, but calls limits.String for every string, byte string and
+	// object key, and limits.Nested before reading the contents of every array and object. Readers
+	// should call limits.String before allocating the string if the format allows it.
+	ReadLimitedValue(limits *ValueLimits) (interface{}, error)
+}
+
+// ValueLimits keeps track of the limits in DecodeOptions while a LimitedReader decodes values.
+type ValueLimits struct {
+	opts        DecodeOptions
+	stringBytes int
+}
+
+// String must be called for every string of n bytes, before it's allocated if possible.
+func (l *ValueLimits) String(n int) error {
+	if l.opts.MaxStringBytes > 0 && n > l.opts.MaxStringBytes-l.stringBytes {
+		return &LimitError{Limit: "MaxStringBytes", Max: l.opts.MaxStringBytes}
+	}
+	l.stringBytes += n
+	return nil
+}
+
+// Nested must be called before reading the contents of an array or object. depth is the number of
+// arrays/objects it's nested inside (zero for a value which isn't nested).
+func (l *ValueLimits) Nested(depth int) error {
+	if l.opts.MaxDepth > 0 && depth >= l.opts.MaxDepth {
+		return &LimitError{Limit: "MaxDepth", Max: l.opts.MaxDepth}
+	}
+	if depth >= maxValueDepth {
+		return errValueTooDeep
+	}
+	return nil
+}
+
+// NewReader wraps a reader so that it returns a *LimitError when one of the limits is exceeded.
+// This can be used together with ApplyPatchFromReader.
+func (opts DecodeOptions) NewReader(r Reader) Reader {
+	return &limitReader{r: r, opts: opts, limits: ValueLimits{opts: opts}}
+}
+
+// ReadPatch reads a whole patch from a reader while enforcing the limits.
+func (opts DecodeOptions) ReadPatch(r Reader) (Patch, error) {
+	var patch Patch
+	err := patch.ReadFrom(opts.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// limitReader is a Reader which enforces DecodeOptions.
+type limitReader struct {
+	r      Reader
+	opts   DecodeOptions
+	ops    int
+	limits ValueLimits
+}
+
+func (r *limitReader) ReadUint8() (uint8, error) {
+	// ReadUint8 is only used for opcodes.
+	v, err := r.r.ReadUint8()
+	if err != nil {
+		return 0, err
+	}
+	r.ops++
+	if r.opts.MaxOps > 0 && r.ops > r.opts.MaxOps {
+		return 0, &LimitError{Limit: "MaxOps", Max: r.opts.MaxOps}
+	}
+	return v, nil
+}
+
+func (r *limitReader) ReadUint() (int, error) {
+	v, err := r.r.ReadUint()
+	if err != nil {
+		return 0, err
+	}
+	if r.opts.MaxIndex > 0 && v > r.opts.MaxIndex {
+		return 0, &LimitError{Limit: "MaxIndex", Max: r.opts.MaxIndex}
+	}
+	return v, nil
+}
+
+func (r *limitReader) ReadString() (string, error) {
+	if lr, ok := r.r.(LimitedReader); ok {
+		return lr.ReadLimitedString(&r.limits)
+	}
+
+	v, err := r.r.ReadString()
+	if err != nil {
+		return "", err
+	}
+	err = r.addString(v)
+	if err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+func (r *limitReader) ReadValue() (interface{}, error) {
+	if r.opts.MaxStringBytes == 0 && r.opts.MaxDepth == 0 {
+		return r.r.ReadValue()
+	}
+
+	if lr, ok := r.r.(LimitedReader); ok {
+		return lr.ReadLimitedValue(&r.limits)
+	}
+
+	v, err := r.r.ReadValue()
+	if err != nil {
+		return nil, err
+	}
+	err = r.checkValue(v, 0)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (r *limitReader) addString(s string) error {
+	return r.limits.String(len(s))
+}
+
+// checkValue checks a value which has already been decoded by a reader which doesn't implement LimitedReader.
+func (r *limitReader) checkValue(v interface{}, depth int) error {
+	switch v := v.(type) {
+	case string:
+		return r.addString(v)
+	case []byte:
+		return r.limits.String(len(v))
+	case map[string]interface{}:
+		if err := r.limits.Nested(depth); err != nil {
+			return err
+		}
+		for key, item := range v {
+			if err := r.addString(key); err != nil {
+				return err
+			}
+			if err := r.checkValue(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if err := r.limits.Nested(depth); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := r.checkValue(item, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package mendoza_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func limitPatch() mendoza.Patch {
+	return mendoza.Patch{
+		&mendoza.OpObjectSetFieldValue{OpValue: mendoza.OpValue{Value: "Bob"}, OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "name"}},
+		&mendoza.OpPushField{Index: 2},
+		&mendoza.OpObjectSetFieldValue{OpValue: mendoza.OpValue{Value: []interface{}{[]interface{}{"a"}}}, OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "tags"}},
+		&mendoza.OpPop{},
+	}
+}
+
+func requireLimitError(t *testing.T, err error, limit string) {
+	var limitErr *mendoza.LimitError
+	require.True(t, errors.As(err, &limitErr), "expected LimitError, got %v", err)
+	require.Equal(t, limit, limitErr.Limit)
+}
+
+func TestDecodeOptions(t *testing.T) {
+	patch := limitPatch()
+	data, err := json.Marshal(patch)
+	require.NoError(t, err)
+
+	var plain []interface{}
+	require.NoError(t, json.Unmarshal(data, &plain))
+
+	for _, tc := range []struct {
+		name  string
+		opts  mendoza.DecodeOptions
+		limit string
+	}{
+		{"Unlimited", mendoza.DecodeOptions{}, ""},
+		{"WithinLimits", mendoza.DecodeOptions{MaxOps: 4, MaxStringBytes: 12, MaxDepth: 2, MaxIndex: 2}, ""},
+		{"MaxOps", mendoza.DecodeOptions{MaxOps: 3}, "MaxOps"},
+		{"MaxStringBytes", mendoza.DecodeOptions{MaxStringBytes: 11}, "MaxStringBytes"},
+		{"MaxDepth", mendoza.DecodeOptions{MaxDepth: 1}, "MaxDepth"},
+		{"MaxIndex", mendoza.DecodeOptions{MaxIndex: 1}, "MaxIndex"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var fromJSON, fromValue mendoza.Patch
+			errJSON := fromJSON.UnmarshalJSONWithOptions(data, tc.opts)
+			errValue := fromValue.DecodeJSONWithOptions(plain, tc.opts)
+
+			if tc.limit == "" {
+				require.NoError(t, errJSON)
+				require.NoError(t, errValue)
+				require.EqualValues(t, patch, fromJSON)
+				require.EqualValues(t, patch, fromValue)
+			} else {
+				requireLimitError(t, errJSON, tc.limit)
+				requireLimitError(t, errValue, tc.limit)
+			}
+		})
+	}
+}
+
+func TestDecodeOptionsReader(t *testing.T) {
+	data, err := json.Marshal(limitPatch())
+	require.NoError(t, err)
+
+	var root interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "Alice", "a": 1, "b": {}}`), &root))
+
+	opts := mendoza.DecodeOptions{MaxOps: 2}
+	_, err = mendoza.ApplyPatchFromReader(root, opts.NewReader(mendoza.NewDecoder(bytes.NewReader(data))))
+	requireLimitError(t, err, "MaxOps")
+}
+
+func TestLargeIndex(t *testing.T) {
+	var patch mendoza.Patch
+	err := patch.UnmarshalJSON([]byte(`[6, 1e300]`))
+	require.Error(t, err)
+}
+
+func TestApplyOptions(t *testing.T) {
+	arr := []interface{}{}
+	for i := 0; i < 100; i++ {
+		arr = append(arr, float64(i))
+	}
+	root := map[string]interface{}{"a": arr}
+
+	// Each operation appends the whole array to the output.
+	patch := mendoza.Patch{&mendoza.OpPushField{Index: 0}, &mendoza.OpBlank{}}
+	for i := 0; i < 20; i++ {
+		patch = append(patch, &mendoza.OpArrayAppendSlice{Left: 0, Right: 100})
+	}
+	patch = append(patch, &mendoza.OpReturnIntoObjectSameKeyPop{})
+
+	result, err := mendoza.TryApplyPatch(root, patch)
+	require.NoError(t, err)
+	require.Len(t, result.(map[string]interface{})["a"], 2000)
+
+	for _, tc := range []struct {
+		name  string
+		opts  mendoza.ApplyOptions
+		limit string
+	}{
+		{"WithinLimits", mendoza.ApplyOptions{MaxOutputSize: 2002, MaxOps: 23, MaxDepth: 1}, ""},
+		{"MaxOutputSize", mendoza.ApplyOptions{MaxOutputSize: 1000}, "MaxOutputSize"},
+		{"MaxOps", mendoza.ApplyOptions{MaxOps: 10}, "MaxOps"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := mendoza.DefaultOptions.WithApplyOptions(tc.opts)
+			_, err := opts.TryApplyPatch(root, patch)
+			if tc.limit == "" {
+				require.NoError(t, err)
+			} else {
+				requireLimitError(t, err, tc.limit)
+			}
+		})
+	}
+}
+
+func TestApplyOptionsMaxDepth(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpBlank{},
+		&mendoza.OpBlank{},
+		&mendoza.OpReturnIntoObject{Key: "a"},
+		&mendoza.OpReturnIntoObject{Key: "b"},
+	}
+
+	opts := mendoza.DefaultOptions.WithApplyOptions(mendoza.ApplyOptions{MaxDepth: 2})
+	result, err := opts.TryApplyPatch(nil, patch)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"b": map[string]interface{}{"a": nil}}, result)
+
+	opts = mendoza.DefaultOptions.WithApplyOptions(mendoza.ApplyOptions{MaxDepth: 1})
+	_, err = opts.TryApplyPatch(nil, patch)
+	requireLimitError(t, err, "MaxDepth")
+}
+
+func TestApplyOptionsMaxDepthInput(t *testing.T) {
+	root := map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{}}}
+	patch := mendoza.Patch{
+		&mendoza.OpPushField{Index: 0},
+		&mendoza.OpPushField{Index: 0},
+		&mendoza.OpPop{},
+		&mendoza.OpPop{},
+	}
+
+	opts := mendoza.DefaultOptions.WithApplyOptions(mendoza.ApplyOptions{MaxDepth: 2})
+	_, err := opts.TryApplyPatch(root, patch)
+	require.NoError(t, err)
+
+	opts = mendoza.DefaultOptions.WithApplyOptions(mendoza.ApplyOptions{MaxDepth: 1})
+	_, err = opts.TryApplyPatch(root, patch)
+	requireLimitError(t, err, "MaxDepth")
+
+	// PushParent also grows the input stack.
+	_, err = opts.TryApplyPatch(root, mendoza.Patch{&mendoza.OpPushField{Index: 0}, &mendoza.OpPushParent{N: 0}})
+	requireLimitError(t, err, "MaxDepth")
+}
+
+func TestDecodeOptionsDeepValue(t *testing.T) {
+	// An OpValue containing a million nested arrays.
+	data := []byte("[0," + strings.Repeat("[", 1000000) + strings.Repeat("]", 1000000) + "]")
+
+	var patch mendoza.Patch
+	err := patch.UnmarshalJSONWithOptions(data, mendoza.DecodeOptions{MaxDepth: 10})
+	requireLimitError(t, err, "MaxDepth")
+
+	err = patch.UnmarshalJSONWithOptions(data, mendoza.DecodeOptions{MaxStringBytes: 10})
+	require.Error(t, err)
+
+	opts := mendoza.DecodeOptions{MaxDepth: 10}
+	_, err = mendoza.ApplyPatchFromReader(nil, opts.NewReader(mendoza.NewDecoder(bytes.NewReader(data))))
+	requireLimitError(t, err, "MaxDepth")
+}
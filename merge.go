@@ -0,0 +1,611 @@
+package mendoza
+
+import (
+	"sort"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// ConflictKind describes why two changes couldn't be merged.
+type ConflictKind int
+
+const (
+	// Both sides changed the same value in different ways.
+	ConflictModify ConflictKind = iota
+	// A deleted a value which B modified.
+	ConflictDeleteModify
+	// A modified a value which B deleted.
+	ConflictModifyDelete
+	// Both sides changed the same part of an array in different ways (e.g. reordered it).
+	ConflictArray
+)
+
+func (kind ConflictKind) String() string {
+	switch kind {
+	case ConflictModify:
+		return "modify"
+	case ConflictDeleteModify:
+		return "delete/modify"
+	case ConflictModifyDelete:
+		return "modify/delete"
+	case ConflictArray:
+		return "array"
+	}
+	return "unknown"
+}
+
+// Conflict describes a change in A which conflicts with a change in B. Base, A and B
+// are the values at the path in each document (nil if the value doesn't exist).
+// For ConflictArray the path refers to the array and the values are the whole arrays.
+type Conflict struct {
+	Path Path
+	Kind ConflictKind
+	Base interface{}
+	A    interface{}
+	B    interface{}
+}
+
+// Merge merges two patches which were created against the same base document. The operations of both
+// patches are interpreted against base (see ChangedPaths), and changes to different fields and different
+// parts of arrays are combined. Values which neither patch touches are never visited, so the cost
+// depends on the size of the patches rather than on the size of the document. When both sides changed
+// the same value a Conflict is reported and the change from A is used.
+//
+// This function uses the default options.
+func Merge(base interface{}, patchA, patchB Patch) (interface{}, []Conflict, error) {
+	return DefaultOptions.Merge(base, patchA, patchB)
+}
+
+// Merge merges two patches which were created against the same base document. Changes to different
+// fields and different parts of arrays are combined. When both sides changed the same value a Conflict
+// is reported and the change from A is used.
+//
+// If either patch can't be applied it returns the same error as TryApplyPatch.
+func (options *Options) Merge(base interface{}, patchA, patchB Patch) (interface{}, []Conflict, error) {
+	m, result, err := options.mergePatches(base, patchA, patchB)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.result(), m.conflicts, nil
+}
+
+// mergePatches interprets both patches and merges them.
+func (options *Options) mergePatches(base interface{}, patchA, patchB Patch) (*merger, *mergedNode, error) {
+	a, err := options.tracePatch(base, patchA)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := options.tracePatch(base, patchB)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := &merger{options: options, b: b}
+	result, err := m.merge(Path{}, mergeBase{path: Path{}, value: a.root, exists: true}, a.result, b.result, Path{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, result, nil
+}
+
+// mergedKind describes where a value in the result of a merge comes from.
+type mergedKind int
+
+const (
+	// The value from A.
+	mergedA mergedKind = iota
+	// The value from B.
+	mergedB
+	// An object which contains changes from both sides.
+	mergedObject
+	// An array which contains changes from both sides.
+	mergedArray
+)
+
+// mergedNode is a value in the result of a merge.
+type mergedNode struct {
+	kind mergedKind
+	// node describes the value for mergedA and mergedB.
+	node *traceNode
+	// theirs is the path of the value in the document produced by B (for mergedB), or the path of
+	// the object/array in that document which the changes were merged into.
+	theirs Path
+	fields map[string]*mergedNode
+	items  []*mergedNode
+}
+
+func (n *mergedNode) result() interface{} {
+	switch n.kind {
+	case mergedObject:
+		obj := make(map[string]interface{}, len(n.fields))
+		for key, field := range n.fields {
+			obj[key] = field.result()
+		}
+		return obj
+	case mergedArray:
+		arr := make([]interface{}, len(n.items))
+		for idx, item := range n.items {
+			arr[idx] = item.result()
+		}
+		return arr
+	}
+	return n.node.result()
+}
+
+// mergeBase is the value in the base document which is being merged.
+type mergeBase struct {
+	path   Path
+	value  interface{}
+	exists bool
+}
+
+func (base mergeBase) child(elem interface{}, value interface{}, exists bool) mergeBase {
+	return mergeBase{path: base.path.child(elem), value: value, exists: exists}
+}
+
+// merger merges the traces of two patches. A nil node means that the value doesn't exist on that side.
+type merger struct {
+	options *Options
+	// b is the trace of patch B, which mergedB values refer to.
+	b         *trace
+	conflicts []Conflict
+}
+
+func (m *merger) conflict(path Path, kind ConflictKind, base interface{}, a, b *traceNode) error {
+	conflict := Conflict{Path: path, Kind: kind}
+	var err error
+	conflict.Base, err = mendoza.ConvertDeep(base, m.options.convertFunc)
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		conflict.A, err = mendoza.ConvertDeep(a.result(), m.options.convertFunc)
+		if err != nil {
+			return err
+		}
+	}
+	if b != nil {
+		conflict.B, err = mendoza.ConvertDeep(b.result(), m.options.convertFunc)
+		if err != nil {
+			return err
+		}
+	}
+	m.conflicts = append(m.conflicts, conflict)
+	return nil
+}
+
+// unchanged returns true if a node is known to be equal to the base value. Values written by the patch are
+// compared against the base value, while modified objects/arrays are never considered unchanged.
+func (m *merger) unchanged(node *traceNode, base mergeBase) (bool, error) {
+	if node == nil || !base.exists {
+		return false, nil
+	}
+	switch node.kind {
+	case traceCopy:
+		return equalPath(node.base, base.path), nil
+	case traceValue, traceString:
+		return m.options.equalValue(node.value, base.value)
+	}
+	return false, nil
+}
+
+// containerKind returns whether a node is an object or an array.
+func (m *merger) containerKind(node *traceNode) (isObject, isArray bool, err error) {
+	switch node.kind {
+	case traceObject:
+		return true, false, nil
+	case traceArray:
+		return false, true, nil
+	case traceString:
+		return false, false, nil
+	}
+	value, err := mendoza.Convert(node.value, m.options.convertFunc)
+	if err != nil {
+		return false, false, err
+	}
+	_, isObject = value.(map[string]interface{})
+	_, isArray = value.([]interface{})
+	return isObject, isArray, nil
+}
+
+// objectFields returns the fields of an object node.
+func (m *merger) objectFields(node *traceNode) (map[string]*traceNode, error) {
+	if node.kind == traceObject {
+		return node.fields, nil
+	}
+	value, err := mendoza.Convert(node.value, m.options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+	obj := value.(map[string]interface{})
+	fields := make(map[string]*traceNode, len(obj))
+	for key, item := range obj {
+		fields[key] = node.child(key, item)
+	}
+	return fields, nil
+}
+
+// arrayItems returns the elements of an array node.
+func (m *merger) arrayItems(node *traceNode) ([]*traceNode, error) {
+	if node.kind == traceArray {
+		return node.items, nil
+	}
+	value, err := mendoza.Convert(node.value, m.options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+	arr := value.([]interface{})
+	items := make([]*traceNode, len(arr))
+	for idx, item := range arr {
+		items[idx] = node.child(idx, item)
+	}
+	return items, nil
+}
+
+// merge merges a single value. path is the path in the result and bPath is the path in the document
+// produced by B. It returns nil if the value should be removed.
+func (m *merger) merge(path Path, base mergeBase, a, b *traceNode, bPath Path) (*mergedNode, error) {
+	takeA := &mergedNode{kind: mergedA, node: a}
+	takeB := &mergedNode{kind: mergedB, node: b, theirs: bPath}
+
+	switch {
+	case a == nil && b == nil:
+		return nil, nil
+	case !base.exists && a == nil:
+		return takeB, nil
+	case !base.exists && b == nil:
+		return takeA, nil
+	}
+
+	aSame, err := m.unchanged(a, base)
+	if err != nil {
+		return nil, err
+	}
+	if aSame {
+		if b == nil {
+			return nil, nil
+		}
+		return takeB, nil
+	}
+
+	if a != nil && b != nil {
+		result, err := m.mergeContainers(path, base, a, b, bPath)
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	bSame, err := m.unchanged(b, base)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bSame && a == nil:
+		return nil, nil
+	case bSame:
+		return takeA, nil
+	case a == nil:
+		return nil, m.conflict(path, ConflictDeleteModify, base.value, a, b)
+	case b == nil:
+		return takeA, m.conflict(path, ConflictModifyDelete, base.value, a, b)
+	}
+
+	equal, err := m.options.equalValue(a.result(), b.result())
+	if err != nil {
+		return nil, err
+	}
+	if equal {
+		return takeB, nil
+	}
+
+	return takeA, m.conflict(path, ConflictModify, base.value, a, b)
+}
+
+// mergeContainers merges two objects field by field or two arrays element by element.
+// It returns nil if the values aren't objects/arrays of the same type as the base value.
+func (m *merger) mergeContainers(path Path, base mergeBase, a, b *traceNode, bPath Path) (*mergedNode, error) {
+	aObject, aArray, err := m.containerKind(a)
+	if err != nil {
+		return nil, err
+	}
+	bObject, bArray, err := m.containerKind(b)
+	if err != nil {
+		return nil, err
+	}
+
+	baseValue, err := mendoza.Convert(base.value, m.options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if aObject && bObject {
+		baseObj, ok := baseValue.(map[string]interface{})
+		if ok || !base.exists {
+			return m.mergeObject(path, base, baseObj, a, b, bPath)
+		}
+	}
+
+	if aArray && bArray {
+		if baseArr, ok := baseValue.([]interface{}); ok && base.exists {
+			return m.mergeArray(path, base, baseArr, a, b, bPath)
+		}
+	}
+
+	return nil, nil
+}
+
+func (m *merger) mergeObject(path Path, base mergeBase, baseObj map[string]interface{}, a, b *traceNode, bPath Path) (*mergedNode, error) {
+	aFields, err := m.objectFields(a)
+	if err != nil {
+		return nil, err
+	}
+	bFields, err := m.objectFields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := sortedFieldKeys(aFields, baseObj)
+	for key := range bFields {
+		if _, ok := aFields[key]; !ok {
+			if _, ok := baseObj[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	result := &mergedNode{kind: mergedObject, theirs: bPath, fields: map[string]*mergedNode{}}
+	for _, key := range keys {
+		baseValue, ok := baseObj[key]
+		field, err := m.merge(path.child(key), base.child(key, baseValue, ok), aFields[key], bFields[key], bPath.child(key))
+		if err != nil {
+			return nil, err
+		}
+		if field != nil {
+			result.fields[key] = field
+		}
+	}
+
+	return result, nil
+}
+
+// elementMatches returns, for every element in the base array, the index of the element in items which was
+// created from it (or -1). The matched indices are always increasing, so elements which were moved before an
+// earlier element are not matched.
+func elementMatches(items []*traceNode, basePath Path, length int) []int {
+	first := make([]int, length)
+	for idx := range first {
+		first[idx] = -1
+	}
+	for idx, item := range items {
+		if baseIdx, ok := childIndex(item.base, basePath); ok && baseIdx < length && first[baseIdx] == -1 {
+			first[baseIdx] = idx
+		}
+	}
+
+	matches := make([]int, length)
+	last := -1
+	for baseIdx, idx := range first {
+		matches[baseIdx] = -1
+		if idx > last {
+			matches[baseIdx] = idx
+			last = idx
+		}
+	}
+	return matches
+}
+
+// mergeArray merges arrays similar to diff3: Elements which are unchanged on both sides
+// split the arrays into chunks, and every chunk is merged separately.
+func (m *merger) mergeArray(path Path, base mergeBase, baseArr []interface{}, a, b *traceNode, bPath Path) (*mergedNode, error) {
+	aItems, err := m.arrayItems(a)
+	if err != nil {
+		return nil, err
+	}
+	bItems, err := m.arrayItems(b)
+	if err != nil {
+		return nil, err
+	}
+
+	matchesA := elementMatches(aItems, base.path, len(baseArr))
+	matchesB := elementMatches(bItems, base.path, len(baseArr))
+
+	c := arrayMerge{
+		merger: m,
+		path:   path,
+		base:   base,
+		arr:    baseArr,
+		a:      aItems,
+		b:      bItems,
+		bPath:  bPath,
+		result: &mergedNode{kind: mergedArray, theirs: bPath, items: []*mergedNode{}},
+	}
+
+	baseStart, aStart, bStart := 0, 0, 0
+
+	for {
+		// Find the next element which is unchanged on both sides.
+		baseEnd, aEnd, bEnd := len(baseArr), len(aItems), len(bItems)
+		for idx := baseStart; idx < len(baseArr); idx++ {
+			if matchesA[idx] == -1 || matchesB[idx] == -1 {
+				continue
+			}
+			elemPath := base.path.child(idx)
+			if aItems[matchesA[idx]].isCopyOf(elemPath) && bItems[matchesB[idx]].isCopyOf(elemPath) {
+				baseEnd, aEnd, bEnd = idx, matchesA[idx], matchesB[idx]
+				break
+			}
+		}
+
+		err := c.mergeChunk(baseStart, baseEnd, aStart, aEnd, bStart, bEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		if baseEnd == len(baseArr) {
+			break
+		}
+
+		c.takeB(bEnd, bEnd+1)
+		baseStart, aStart, bStart = baseEnd+1, aEnd+1, bEnd+1
+	}
+
+	if c.conflicted {
+		err := m.conflict(path, ConflictArray, base.value, a, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.result, nil
+}
+
+// arrayMerge keeps track of an array which is being merged.
+type arrayMerge struct {
+	*merger
+	path       Path
+	base       mergeBase
+	arr        []interface{}
+	a, b       []*traceNode
+	bPath      Path
+	result     *mergedNode
+	conflicted bool
+}
+
+func (c *arrayMerge) takeA(start, end int) {
+	for _, item := range c.a[start:end] {
+		c.result.items = append(c.result.items, &mergedNode{kind: mergedA, node: item})
+	}
+}
+
+func (c *arrayMerge) takeB(start, end int) {
+	for idx := start; idx < end; idx++ {
+		c.result.items = append(c.result.items, &mergedNode{kind: mergedB, node: c.b[idx], theirs: c.bPath.child(idx)})
+	}
+}
+
+// unchangedElements returns true if the items are the elements of the base array between start and end.
+func (c *arrayMerge) unchangedElements(items []*traceNode, start, end int) (bool, error) {
+	if len(items) != end-start {
+		return false, nil
+	}
+	for idx, item := range items {
+		same, err := c.unchanged(item, c.base.child(start+idx, c.arr[start+idx], true))
+		if err != nil || !same {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// notMoved returns true if none of the items were moved from another element of the base array,
+// so that every item can be merged with the base element at the same position.
+func (c *arrayMerge) notMoved(start, end int, items []*traceNode, baseStart int) bool {
+	for idx := start; idx < end; idx++ {
+		if baseIdx, ok := childIndex(items[idx].base, c.base.path); ok && baseIdx != baseStart+idx-start {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *arrayMerge) mergeChunk(baseStart, baseEnd, aStart, aEnd, bStart, bEnd int) error {
+	aSame, err := c.unchangedElements(c.a[aStart:aEnd], baseStart, baseEnd)
+	if err != nil {
+		return err
+	}
+	if aSame {
+		c.takeB(bStart, bEnd)
+		return nil
+	}
+
+	if baseEnd-baseStart == aEnd-aStart && aEnd-aStart == bEnd-bStart && c.notMoved(aStart, aEnd, c.a, baseStart) && c.notMoved(bStart, bEnd, c.b, baseStart) {
+		// The same elements were modified on both sides so we can merge them one by one.
+		for idx := 0; idx < aEnd-aStart; idx++ {
+			baseIdx := baseStart + idx
+			item, err := c.merge(c.path.child(len(c.result.items)), c.base.child(baseIdx, c.arr[baseIdx], true), c.a[aStart+idx], c.b[bStart+idx], c.bPath.child(bStart+idx))
+			if err != nil {
+				return err
+			}
+			c.result.items = append(c.result.items, item)
+		}
+		return nil
+	}
+
+	bSame, err := c.unchangedElements(c.b[bStart:bEnd], baseStart, baseEnd)
+	if err != nil {
+		return err
+	}
+	if bSame {
+		c.takeA(aStart, aEnd)
+		return nil
+	}
+
+	equal := aEnd-aStart == bEnd-bStart
+	for idx := 0; equal && idx < aEnd-aStart; idx++ {
+		equal, err = c.options.equalValue(c.a[aStart+idx].result(), c.b[bStart+idx].result())
+		if err != nil {
+			return err
+		}
+	}
+	if equal {
+		c.takeB(bStart, bEnd)
+		return nil
+	}
+
+	c.conflicted = true
+	c.takeA(aStart, aEnd)
+	return nil
+}
+
+// equalValue compares two values like equalValues, but stops at the first difference so
+// that comparing a small value against a large value is cheap.
+func (options *Options) equalValue(a, b interface{}) (bool, error) {
+	a, err := mendoza.Convert(a, options.convertFunc)
+	if err != nil {
+		return false, err
+	}
+	b, err = mendoza.Convert(b, options.convertFunc)
+	if err != nil {
+		return false, err
+	}
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false, nil
+		}
+		for key, item := range a {
+			other, ok := b[key]
+			if !ok {
+				return false, nil
+			}
+			equal, err := options.equalValue(item, other)
+			if err != nil || !equal {
+				return false, err
+			}
+		}
+		return true, nil
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false, nil
+		}
+		for idx := range a {
+			equal, err := options.equalValue(a[idx], b[idx])
+			if err != nil || !equal {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	switch b.(type) {
+	case map[string]interface{}, []interface{}:
+		return false, nil
+	}
+	return options.equalValues(a, b)
+}
@@ -0,0 +1,240 @@
+package mendoza_test
+
+import (
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func merge(t *testing.T, base, a, b interface{}) (interface{}, []mendoza.Conflict) {
+	patchA, err := mendoza.CreatePatch(base, a)
+	require.NoError(t, err)
+	patchB, err := mendoza.CreatePatch(base, b)
+	require.NoError(t, err)
+
+	result, conflicts, err := mendoza.Merge(base, patchA, patchB)
+	require.NoError(t, err)
+	return result, conflicts
+}
+
+func TestMerge(t *testing.T) {
+	base := map[string]interface{}{
+		"name": "Michael Bluth",
+		"age":  35.0,
+		"address": map[string]interface{}{
+			"street": "1 Model Home",
+			"zip":    92660.0,
+		},
+		"skills": []interface{}{"business", "banana stand", "dancing"},
+	}
+
+	t.Run("Disjoint", func(t *testing.T) {
+		a := map[string]interface{}{
+			"name": "Michael",
+			"age":  35.0,
+			"address": map[string]interface{}{
+				"street": "1 Model Home",
+				"zip":    92661.0,
+			},
+			"skills": []interface{}{"business", "banana stand", "dancing", "lying"},
+		}
+		b := map[string]interface{}{
+			"name": "Michael Bluth",
+			"address": map[string]interface{}{
+				"street": "2 Model Home",
+				"zip":    92660.0,
+			},
+			"skills": []interface{}{"management", "banana stand", "dancing"},
+			"son":    "George Michael",
+		}
+
+		result, conflicts := merge(t, base, a, b)
+		require.Empty(t, conflicts)
+		require.Equal(t, map[string]interface{}{
+			"name": "Michael",
+			"address": map[string]interface{}{
+				"street": "2 Model Home",
+				"zip":    92661.0,
+			},
+			"skills": []interface{}{"management", "banana stand", "dancing", "lying"},
+			"son":    "George Michael",
+		}, result)
+	})
+
+	t.Run("Modify", func(t *testing.T) {
+		a := map[string]interface{}{"name": "Michael", "age": 35.0}
+		b := map[string]interface{}{"name": "Mike", "age": 36.0}
+
+		result, conflicts := merge(t, base, a, b)
+		require.Equal(t, map[string]interface{}{"name": "Michael", "age": 36.0}, result)
+		require.Equal(t, []mendoza.Conflict{
+			{Path: mendoza.Path{"name"}, Kind: mendoza.ConflictModify, Base: "Michael Bluth", A: "Michael", B: "Mike"},
+		}, conflicts)
+	})
+
+	t.Run("DeleteModify", func(t *testing.T) {
+		a := map[string]interface{}{
+			"name":   "Michael Bluth",
+			"age":    35.0,
+			"skills": []interface{}{"business", "banana stand", "dancing"},
+		}
+		b := map[string]interface{}{
+			"name": "Michael Bluth",
+			"age":  35.0,
+			"address": map[string]interface{}{
+				"street": "1 Model Home",
+				"zip":    92661.0,
+			},
+			"skills": []interface{}{"business", "banana stand", "dancing"},
+		}
+
+		result, conflicts := merge(t, base, a, b)
+		require.Equal(t, a, result)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, mendoza.ConflictDeleteModify, conflicts[0].Kind)
+		require.Equal(t, "/address", conflicts[0].Path.String())
+		require.Nil(t, conflicts[0].A)
+
+		result, conflicts = merge(t, base, b, a)
+		require.Equal(t, b, result)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, mendoza.ConflictModifyDelete, conflicts[0].Kind)
+	})
+
+	t.Run("NestedModify", func(t *testing.T) {
+		a := map[string]interface{}{"address": map[string]interface{}{"zip": 1.0}}
+		b := map[string]interface{}{"address": map[string]interface{}{"zip": 2.0}}
+
+		result, conflicts := merge(t, base, a, b)
+		require.Equal(t, a, result)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, "/address/zip", conflicts[0].Path.String())
+	})
+
+	t.Run("ArrayElements", func(t *testing.T) {
+		base := []interface{}{
+			map[string]interface{}{"name": "Michael", "age": 35.0},
+			map[string]interface{}{"name": "Gob", "age": 37.0},
+		}
+		a := []interface{}{
+			map[string]interface{}{"name": "Michael", "age": 36.0},
+			map[string]interface{}{"name": "Gob", "age": 37.0},
+		}
+		b := []interface{}{
+			map[string]interface{}{"name": "Michael Bluth", "age": 35.0},
+			map[string]interface{}{"name": "Gob", "age": 37.0},
+		}
+
+		result, conflicts := merge(t, base, a, b)
+		require.Empty(t, conflicts)
+		require.Equal(t, []interface{}{
+			map[string]interface{}{"name": "Michael Bluth", "age": 36.0},
+			map[string]interface{}{"name": "Gob", "age": 37.0},
+		}, result)
+	})
+
+	t.Run("Reorder", func(t *testing.T) {
+		a := map[string]interface{}{
+			"name":    "Michael Bluth",
+			"age":     35.0,
+			"address": base["address"],
+			"skills":  []interface{}{"dancing", "business", "banana stand"},
+		}
+		b := map[string]interface{}{
+			"name":    "Michael Bluth",
+			"age":     35.0,
+			"address": base["address"],
+			"skills":  []interface{}{"banana stand", "business"},
+		}
+
+		result, conflicts := merge(t, base, a, b)
+		require.Equal(t, a, result)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, mendoza.ConflictArray, conflicts[0].Kind)
+		require.Equal(t, "/skills", conflicts[0].Path.String())
+	})
+
+	t.Run("ReorderModify", func(t *testing.T) {
+		base := map[string]interface{}{
+			"l": []interface{}{
+				map[string]interface{}{"k": "a"},
+				map[string]interface{}{"k": "b"},
+				map[string]interface{}{"k": "c"},
+			},
+		}
+		a := map[string]interface{}{
+			"l": []interface{}{
+				map[string]interface{}{"k": "c"},
+				map[string]interface{}{"k": "b"},
+				map[string]interface{}{"k": "a"},
+			},
+		}
+		b := map[string]interface{}{
+			"l": []interface{}{
+				map[string]interface{}{"k": "a", "z": 1.0},
+				map[string]interface{}{"k": "b"},
+				map[string]interface{}{"k": "c"},
+			},
+		}
+
+		// The change in B must not be applied to another element.
+		result, conflicts := merge(t, base, a, b)
+		require.Equal(t, a, result)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, mendoza.ConflictArray, conflicts[0].Kind)
+		require.Equal(t, "/l", conflicts[0].Path.String())
+
+		result, conflicts = merge(t, base, b, a)
+		require.Equal(t, b, result)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, mendoza.ConflictArray, conflicts[0].Kind)
+	})
+
+	t.Run("Untouched", func(t *testing.T) {
+		items := make([]interface{}, 10000)
+		for idx := range items {
+			items[idx] = float64(idx)
+		}
+		base := map[string]interface{}{
+			"name":  "Michael Bluth",
+			"age":   35.0,
+			"items": items,
+		}
+
+		patchA := mendoza.Patch{
+			&mendoza.OpValue{Value: "Michael"},
+			&mendoza.OpReturnIntoObject{Key: "name"},
+		}
+		patchB := mendoza.Patch{
+			&mendoza.OpObjectDeleteField{Index: 0},
+		}
+
+		result, conflicts, err := mendoza.Merge(base, patchA, patchB)
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+		require.Equal(t, map[string]interface{}{
+			"name":  "Michael",
+			"items": items,
+		}, result)
+
+		// Values which aren't touched by any of the patches are used as they are.
+		resultItems := result.(map[string]interface{})["items"].([]interface{})
+		require.True(t, &resultItems[0] == &items[0])
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		opts := mendoza.DefaultOptions.WithBaseFingerprint(true)
+		patch, err := opts.CreatePatch(base, "hello")
+		require.NoError(t, err)
+
+		_, _, err = opts.Merge("other", patch, patch)
+		require.Equal(t, mendoza.ErrBaseMismatch, err)
+	})
+}
+
+func TestPath(t *testing.T) {
+	require.Equal(t, "", mendoza.Path{}.String())
+	require.Equal(t, "/users/0/name", mendoza.Path{"users", 0, "name"}.String())
+	require.Equal(t, "/a~1b/m~0n", mendoza.Path{"a/b", "m~n"}.String())
+}
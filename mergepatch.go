@@ -0,0 +1,63 @@
+package mendoza
+
+import (
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// FromMergePatch converts a JSON Merge Patch (RFC 7386) into a patch. The merge patch is applied to
+// base and a patch is created between base and the result, so the patch is as compact as one created
+// by CreatePatch.
+//
+// This function uses the default options.
+func FromMergePatch(base interface{}, merge interface{}) (Patch, error) {
+	return DefaultOptions.FromMergePatch(base, merge)
+}
+
+// FromMergePatch converts a JSON Merge Patch (RFC 7386) into a patch.
+func (options *Options) FromMergePatch(base interface{}, merge interface{}) (Patch, error) {
+	result, err := options.applyMergePatch(base, merge)
+	if err != nil {
+		return nil, err
+	}
+
+	return options.CreatePatch(base, result)
+}
+
+// applyMergePatch applies a merge patch without modifying the target. Objects are copied as they're modified.
+func (options *Options) applyMergePatch(target interface{}, merge interface{}) (interface{}, error) {
+	merge, err := mendoza.Convert(merge, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	mergeObj, ok := merge.(map[string]interface{})
+	if !ok {
+		return merge, nil
+	}
+
+	target, err = mendoza.Convert(target, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	targetObj, _ := target.(map[string]interface{})
+
+	result := make(map[string]interface{}, len(targetObj))
+	for key, value := range targetObj {
+		result[key] = value
+	}
+
+	for key, value := range mergeObj {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+
+		result[key], err = options.applyMergePatch(result[key], value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
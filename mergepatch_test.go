@@ -0,0 +1,64 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+// Examples from Appendix A of RFC 7386.
+var mergePatchExamples = []struct {
+	base   string
+	merge  string
+	result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestFromMergePatch(t *testing.T) {
+	for _, example := range mergePatchExamples {
+		var base, merge, expected interface{}
+		require.NoError(t, json.Unmarshal([]byte(example.base), &base))
+		require.NoError(t, json.Unmarshal([]byte(example.merge), &merge))
+		require.NoError(t, json.Unmarshal([]byte(example.result), &expected))
+
+		patch, err := mendoza.FromMergePatch(base, merge)
+		require.NoError(t, err)
+		require.Equal(t, expected, mendoza.ApplyPatch(base, patch), example.merge)
+	}
+
+	t.Run("Compact", func(t *testing.T) {
+		base := map[string]interface{}{
+			"name":  "Michael Bluth",
+			"long":  "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz",
+			"items": []interface{}{1.0, 2.0, 3.0, 4.0, 5.0},
+		}
+
+		patch, err := mendoza.FromMergePatch(base, map[string]interface{}{"name": "Michael"})
+		require.NoError(t, err)
+
+		expected, err := mendoza.CreatePatch(base, map[string]interface{}{
+			"name":  "Michael",
+			"long":  base["long"],
+			"items": base["items"],
+		})
+		require.NoError(t, err)
+		require.Equal(t, expected, patch)
+	})
+}
@@ -0,0 +1,115 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberTypes(t *testing.T) {
+	left := map[string]interface{}{"a": int64(5), "b": uint8(1), "c": json.Number("2.5"), "d": float32(0.5)}
+	right := map[string]interface{}{"a": 5.0, "b": 1.0, "c": 2.5, "d": 0.5}
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.Empty(t, patch)
+
+	right = map[string]interface{}{"a": int64(6), "b": uint8(1), "c": json.Number("2.5"), "d": float32(0.5)}
+	patch, err = mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+}
+
+func TestLargeIntegers(t *testing.T) {
+	left := map[string]interface{}{"id": json.Number("9007199254740993"), "big": json.Number("123456789012345678901234567890")}
+	right := map[string]interface{}{"id": json.Number("9007199254740995"), "big": json.Number("123456789012345678901234567890")}
+
+	// These are equal as float64, but must still be treated as different.
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.NotEmpty(t, patch)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+
+	b, err := json.Marshal(patch)
+	require.NoError(t, err)
+
+	var decoded mendoza.Patch
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.EqualValues(t, patch, decoded)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, decoded))
+
+	left = map[string]interface{}{"id": int64(1<<62 + 1)}
+	right = map[string]interface{}{"id": int64(1<<62 + 2)}
+	patch, err = mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.NotEmpty(t, patch)
+
+	b, err = json.Marshal(patch)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.EqualValues(t, map[string]interface{}{"id": json.Number("4611686018427387906")}, mendoza.ApplyPatch(left, decoded))
+}
+
+func TestDecimals(t *testing.T) {
+	// These are rounded to the same float64, but must still be treated as different.
+	left := map[string]interface{}{"a": json.Number("0.1000000000000000000001")}
+	right := map[string]interface{}{"a": json.Number("0.1")}
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.NotEmpty(t, patch)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+
+	// Equal values are equal regardless of representation.
+	for _, pair := range [][2]interface{}{
+		{json.Number("0.1"), 0.1},
+		{json.Number("0.10"), json.Number("1e-1")},
+		{json.Number("1.0"), int64(1)},
+		{json.Number("1.5e3"), 1500.0},
+		{json.Number("9007199254740993.0"), json.Number("9007199254740993")},
+	} {
+		patch, err := mendoza.CreatePatch(map[string]interface{}{"a": pair[0]}, map[string]interface{}{"a": pair[1]})
+		require.NoError(t, err)
+		require.Empty(t, patch, "%v = %v", pair[0], pair[1])
+	}
+
+	_, err = mendoza.CreatePatch(json.Number("1e999999999999"), nil)
+	require.Error(t, err)
+}
+
+func TestDecimalsJSON(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpValue{Value: []interface{}{
+			json.Number("0.1000000000000000000001"),
+			json.Number("1.0"),
+			json.Number("1e21"),
+			json.Number("123456789.123456789123456789"),
+			0.1,
+			1e21,
+			-2.5,
+		}},
+	}
+
+	b, err := json.Marshal(patch)
+	require.NoError(t, err)
+	require.Equal(t, `[0,[0.1000000000000000000001,1.0,1e21,123456789.123456789123456789,0.1,1e+21,-2.5]]`, string(b))
+
+	var decoded mendoza.Patch
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.EqualValues(t, mendoza.Patch{
+		&mendoza.OpValue{Value: []interface{}{
+			json.Number("0.1000000000000000000001"),
+			json.Number("1.0"),
+			json.Number("1e21"),
+			json.Number("123456789.123456789123456789"),
+			0.1,
+			1e21,
+			-2.5,
+		}},
+	}, decoded)
+
+	b2, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	require.Equal(t, string(b), string(b2))
+}
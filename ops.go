@@ -16,6 +16,18 @@
 //  []interface{}
 //  nil
 //
+// Numbers can also be given as float32, signed/unsigned integers or json.Number. Numbers are
+// compared by their exact value (e.g. int64(5) is equal to float64(5) and json.Number("5.0")), so
+// large integers and decimals with more precision than a float64 are never rounded. Values in the
+// patch keep their original type, and the JSON encoding only decodes a number as float64 if that
+// doesn't change how it's written.
+//
+// Other Go values (structs, pointers, typed maps and slices, json.Marshaler) are converted
+// using reflection, following the same rules as encoding/json (e.g. `json:"name,omitempty"`).
+// Values stored in a patch are always converted to the types above, but values which the
+// patcher copies from the original document keep their Go type. Use ApplyPatchInto to decode
+// the result back into a typed value.
+//
 // If you need to support additional types you can use the option WithConvertFunc which
 // defines a function that is applied to every value.
 package mendoza
@@ -24,7 +36,7 @@ package mendoza
 
 // Op is the interface for an operation.
 type Op interface {
-	applyTo(p *patcher)
+	applyTo(p *patcher) error
 	readParams(r Reader) error
 	writeParams(w Writer) error
 }
@@ -150,3 +162,12 @@ type OpStringAppendSlice struct {
 	Left  int
 	Right int
 }
+
+// Assertions
+
+// OpAssertFingerprint verifies that the current input value has the given fingerprint.
+// It's placed at the beginning of a patch (see WithBaseFingerprint) in order to detect
+// that the patch is applied against the wrong document.
+type OpAssertFingerprint struct {
+	Fingerprint Fingerprint
+}
@@ -1,7 +1,14 @@
 package mendoza
 
 type Options struct {
-	convertFunc func(value interface{}) interface{}
+	convertFunc          func(value interface{}) interface{}
+	baseFingerprint      bool
+	maxCandidates        int
+	disableFuzzyMatching bool
+	maxDepth             int
+	stringDiff           StringDiff
+	fallbackOnCancel     bool
+	applyOptions         ApplyOptions
 }
 
 // The default options.
@@ -15,3 +22,67 @@ func (options Options) WithConvertFunc(convertFunc func(value interface{}) inter
 	options.convertFunc = convertFunc
 	return options
 }
+
+// WithBaseFingerprint creates a new option object which controls whether patches embed
+// the fingerprint of the left document.
+//
+// When enabled, CreatePatch and CreateDoublePatch start every patch with an OpAssertFingerprint,
+// and applying the patch to any other document fails with ErrBaseMismatch before doing any work.
+func (options Options) WithBaseFingerprint(enabled bool) Options {
+	options.baseFingerprint = enabled
+	return options
+}
+
+// WithMaxCandidates creates a new option object which limits how many candidate objects/arrays
+// the differ explores per request. Exploring fewer candidates is faster, but might produce larger patches.
+//
+// Zero (the default) means no limit.
+func (options Options) WithMaxCandidates(n int) Options {
+	options.maxCandidates = n
+	return options
+}
+
+// WithFuzzyMatching creates a new option object which controls whether the differ uses the xor-index
+// to find objects that differ in a single field (e.g. a field which has been renamed or moved).
+//
+// This is enabled by default. Disabling it is faster, but might produce larger patches.
+func (options Options) WithFuzzyMatching(enabled bool) Options {
+	options.disableFuzzyMatching = !enabled
+	return options
+}
+
+// WithMaxDepth creates a new option object which limits how deep into the document the differ looks for changes.
+// A changed value nested deeper than this is replaced as a whole instead of being patched.
+//
+// Zero (the default) means no limit.
+func (options Options) WithMaxDepth(depth int) Options {
+	options.maxDepth = depth
+	return options
+}
+
+// WithStringDiff creates a new option object which controls how the differ finds the differences between strings.
+//
+// The default (StringDiffAffix) only reuses the common prefix and suffix of a string. The other modes find
+// common lines/words/characters which produce smaller patches for long strings with multiple edits, at the cost of
+// more time spent diffing.
+func (options Options) WithStringDiff(mode StringDiff) Options {
+	options.stringDiff = mode
+	return options
+}
+
+// WithFallbackOnCancel creates a new option object which controls what CreatePatchContext does when the context
+// is cancelled (e.g. the deadline is exceeded) before the patch is complete.
+//
+// By default the context's error is returned. When enabled it instead returns a (large, but correct) patch
+// which replaces the whole document with the right document.
+func (options Options) WithFallbackOnCancel(enabled bool) Options {
+	options.fallbackOnCancel = enabled
+	return options
+}
+
+// WithApplyOptions creates a new option object which limits the resources used when applying a patch.
+// See ApplyOptions for the available limits.
+func (options Options) WithApplyOptions(applyOptions ApplyOptions) Options {
+	options.applyOptions = applyOptions
+	return options
+}
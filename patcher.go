@@ -1,7 +1,12 @@
 package mendoza
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"sort"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
 )
 
 type outputEntry struct {
@@ -15,6 +20,13 @@ type inputEntry struct {
 	key    string
 	value  interface{}
 	fields []fieldEntry
+
+	// parent is the position of the parent on the input stack (-1 for the root) and index is the
+	// field/element index of this value in the parent. They're used to find the entry of the value
+	// in the hash list of the root (hashIdx, -1 until it's needed).
+	parent  int
+	index   int
+	hashIdx int
 }
 
 type fieldEntry struct {
@@ -27,6 +39,54 @@ type patcher struct {
 	inputStack  []inputEntry
 	outputStack []outputEntry
 	options     *Options
+	ops         int
+	outputSize  int
+
+	// hashList is the hash list of the root, created by the first OpAssertFingerprint.
+	// children contains the indices of the child entries of a container in the hash list.
+	hashList *mendoza.HashList
+	children map[int][]int
+}
+
+// ApplyError is returned when an operation in a patch can't be applied to the document.
+// This typically happens when the patch was created for a different document.
+type ApplyError struct {
+	// Index is the position of the failing operation in the patch.
+	Index int
+	// Op is the failing operation.
+	Op Op
+	// Expected describes what the operation expected to find on the stacks.
+	Expected string
+	// Found describes what was actually found.
+	Found string
+}
+
+func (err *ApplyError) Error() string {
+	return fmt.Sprintf("mendoza: op %d (%T): expected %s, found %s", err.Index, err.Op, err.Expected, err.Found)
+}
+
+func mismatch(expected string, found string) error {
+	return &ApplyError{Expected: expected, Found: found}
+}
+
+// describe returns a short description of a value for use in error messages.
+func describe(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
 }
 
 // Applies a patch to a document. Note that this method can panic if
@@ -40,40 +100,185 @@ func ApplyPatch(root interface{}, patch Patch) interface{} {
 // Applies a patch to a document. Note that this method can panic if
 // the document is not the same that was used to produce the patch.
 func (options *Options) ApplyPatch(root interface{}, patch Patch) interface{} {
+	result, err := options.TryApplyPatch(root, patch)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// ApplyPatchInto applies a patch to a document and decodes the result into dst (which
+// must be a pointer) using encoding/json.
+//
+// This function uses the default options.
+func ApplyPatchInto(dst interface{}, root interface{}, patch Patch) error {
+	return DefaultOptions.ApplyPatchInto(dst, root, patch)
+}
+
+// ApplyPatchInto applies a patch to a document and decodes the result into dst (which
+// must be a pointer) using encoding/json.
+func (options *Options) ApplyPatchInto(dst interface{}, root interface{}, patch Patch) error {
+	result, err := options.TryApplyPatch(root, patch)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, dst)
+}
+
+// TryApplyPatch applies a patch to a document. Unlike ApplyPatch it never panics: If the
+// document is not the same that was used to produce the patch it returns an *ApplyError
+// describing the first operation which failed.
+//
+// This function uses the default options.
+func TryApplyPatch(root interface{}, patch Patch) (interface{}, error) {
+	return DefaultOptions.TryApplyPatch(root, patch)
+}
+
+// TryApplyPatch applies a patch to a document. Unlike ApplyPatch it never panics: If the
+// document is not the same that was used to produce the patch it returns an *ApplyError
+// describing the first operation which failed.
+func (options *Options) TryApplyPatch(root interface{}, patch Patch) (interface{}, error) {
 	if len(patch) == 0 {
-		return root
+		return root, nil
 	}
 
-	if options.convertFunc != nil {
-		root = options.convertFunc(root)
+	p, err := options.newPatcher(root)
+	if err != nil {
+		return nil, err
 	}
 
-	p := patcher{
+	for idx, op := range patch {
+		err := p.step(idx, op)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.result(), nil
+}
+
+// ApplyPatchFromReader reads a patch from a reader and applies each operation as soon as it has been
+// read, without keeping the whole patch in memory. It stops at the first operation which can't be read
+// (returning the error from the reader) or applied (returning an *ApplyError, see TryApplyPatch).
+//
+// This function uses the default options.
+func ApplyPatchFromReader(root interface{}, r Reader) (interface{}, error) {
+	return DefaultOptions.ApplyPatchFromReader(root, r)
+}
+
+// ApplyPatchFromReader reads a patch from a reader and applies each operation as soon as it has been
+// read, without keeping the whole patch in memory.
+func (options *Options) ApplyPatchFromReader(root interface{}, r Reader) (interface{}, error) {
+	p, err := options.newPatcher(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := 0; ; idx++ {
+		op, err := ReadFrom(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.step(idx, op)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.result(), nil
+}
+
+func (options *Options) newPatcher(root interface{}) (*patcher, error) {
+	root, err := mendoza.Convert(root, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &patcher{
 		options:     options,
-		inputStack:  []inputEntry{{value: root}},
+		inputStack:  []inputEntry{{value: root, parent: -1}},
 		outputStack: []outputEntry{{source: root}},
+	}, nil
+}
+
+// step applies a single operation. idx is the position of the operation in the patch and is used for errors.
+func (patcher *patcher) step(idx int, op Op) error {
+	patcher.ops++
+	if max := patcher.options.applyOptions.MaxOps; max > 0 && patcher.ops > max {
+		return &LimitError{Limit: "MaxOps", Max: max}
 	}
 
-	for _, op := range patch {
-		op.applyTo(&p)
+	err := op.applyTo(patcher)
+	if applyErr, ok := err.(*ApplyError); ok {
+		applyErr.Index = idx
+		applyErr.Op = op
 	}
+	return err
+}
 
-	return p.result()
+func (patcher *patcher) pushInput(entry inputEntry) error {
+	if max := patcher.options.applyOptions.MaxDepth; max > 0 && len(patcher.inputStack) > max {
+		return &LimitError{Limit: "MaxDepth", Max: max}
+	}
+	patcher.inputStack = append(patcher.inputStack, entry)
+	return nil
+}
+
+// pushChild pushes a field/element of the current input value.
+func (patcher *patcher) pushChild(key string, value interface{}, index int) error {
+	return patcher.pushInput(inputEntry{
+		key:     key,
+		value:   value,
+		parent:  len(patcher.inputStack) - 1,
+		index:   index,
+		hashIdx: -1,
+	})
 }
 
-func (patcher *patcher) popInput() {
-	patcher.inputStack = patcher.inputStack[:len(patcher.inputStack)-1]
+func (patcher *patcher) pushOutput(entry outputEntry) error {
+	if max := patcher.options.applyOptions.MaxDepth; max > 0 && len(patcher.outputStack) > max {
+		return &LimitError{Limit: "MaxDepth", Max: max}
+	}
+	patcher.outputStack = append(patcher.outputStack, entry)
+	return nil
 }
 
-func (patcher *patcher) popOutput() {
-	patcher.outputStack = patcher.outputStack[:len(patcher.outputStack)-1]
+// grow records that n array elements, object fields or string bytes are about to be written.
+func (patcher *patcher) grow(n int) error {
+	patcher.outputSize += n
+	if max := patcher.options.applyOptions.MaxOutputSize; max > 0 && patcher.outputSize > max {
+		return &LimitError{Limit: "MaxOutputSize", Max: max}
+	}
+	return nil
 }
 
-func (patcher *patcher) inputEntry() *inputEntry {
-	if len(patcher.inputStack) == 0 {
+func (patcher *patcher) popInput() error {
+	if len(patcher.inputStack) < 2 {
+		return mismatch("pushed value on input stack", "only the root")
+	}
+	patcher.inputStack = patcher.inputStack[:len(patcher.inputStack)-1]
+	return nil
+}
 
+func (patcher *patcher) popOutput() error {
+	if len(patcher.outputStack) < 2 {
+		return mismatch("pushed value on output stack", "only the root")
 	}
+	patcher.outputStack = patcher.outputStack[:len(patcher.outputStack)-1]
+	return nil
+}
 
+func (patcher *patcher) inputEntry() *inputEntry {
 	return &patcher.inputStack[len(patcher.inputStack)-1]
 }
 
@@ -97,10 +302,13 @@ func (entry *outputEntry) result() interface{} {
 	return entry.source
 }
 
-func (entry *inputEntry) getField(idx int) fieldEntry {
+func (entry *inputEntry) getField(idx int) (fieldEntry, error) {
 	if entry.fields == nil {
+		obj, ok := entry.value.(map[string]interface{})
+		if !ok {
+			return fieldEntry{}, mismatch("object on input stack", describe(entry.value))
+		}
 		fields := []fieldEntry{}
-		obj := entry.value.(map[string]interface{})
 		keys := []string{}
 		for key := range obj {
 			keys = append(keys, key)
@@ -116,19 +324,32 @@ func (entry *inputEntry) getField(idx int) fieldEntry {
 		entry.fields = fields
 	}
 
-	return entry.fields[idx]
-}
+	if idx < 0 || idx >= len(entry.fields) {
+		return fieldEntry{}, mismatch(
+			fmt.Sprintf("field index %d on input stack", idx),
+			fmt.Sprintf("object with %d fields", len(entry.fields)),
+		)
+	}
 
-func (patcher *patcher) inputObject() map[string]interface{} {
-	return patcher.inputEntry().value.(map[string]interface{})
+	return entry.fields[idx], nil
 }
 
-func (patcher *patcher) inputArray() []interface{} {
-	return patcher.inputEntry().value.([]interface{})
+func (patcher *patcher) inputArray() ([]interface{}, error) {
+	value := patcher.inputEntry().value
+	arr, ok := value.([]interface{})
+	if !ok {
+		return nil, mismatch("array on input stack", describe(value))
+	}
+	return arr, nil
 }
 
-func (patcher *patcher) inputString() string {
-	return patcher.inputEntry().value.(string)
+func (patcher *patcher) inputString() (string, error) {
+	value := patcher.inputEntry().value
+	str, ok := value.(string)
+	if !ok {
+		return "", mismatch("string on input stack", describe(value))
+	}
+	return str, nil
 }
 
 func (patcher *patcher) result() interface{} {
@@ -136,14 +357,24 @@ func (patcher *patcher) result() interface{} {
 	return entry.result()
 }
 
-func (patcher *patcher) outputObject() map[string]interface{} {
+func (patcher *patcher) outputObject() (map[string]interface{}, error) {
 	entry := &patcher.outputStack[len(patcher.outputStack)-1]
 
 	if entry.writableObject == nil {
+		if entry.writableArray != nil || len(entry.writableString) > 0 {
+			return nil, mismatch("object on output stack", describe(entry.result()))
+		}
+
 		if entry.source == nil {
 			entry.writableObject = make(map[string]interface{})
 		} else {
-			src := entry.source.(map[string]interface{})
+			src, ok := entry.source.(map[string]interface{})
+			if !ok {
+				return nil, mismatch("object on output stack", describe(entry.source))
+			}
+			if err := patcher.grow(len(src)); err != nil {
+				return nil, err
+			}
 			obj := make(map[string]interface{}, len(src))
 
 			for k, v := range src {
@@ -153,178 +384,375 @@ func (patcher *patcher) outputObject() map[string]interface{} {
 		}
 	}
 
-	return entry.writableObject
+	return entry.writableObject, nil
 }
 
-func (patcher *patcher) outputArray() *[]interface{} {
+func (patcher *patcher) outputArray() (*[]interface{}, error) {
 	entry := &patcher.outputStack[len(patcher.outputStack)-1]
 
+	if entry.writableObject != nil || len(entry.writableString) > 0 {
+		return nil, mismatch("array on output stack", describe(entry.result()))
+	}
+
 	if entry.source != nil {
-		src := entry.source.([]interface{})
+		src, ok := entry.source.([]interface{})
+		if !ok {
+			return nil, mismatch("array on output stack", describe(entry.source))
+		}
+		if err := patcher.grow(len(src)); err != nil {
+			return nil, err
+		}
 		entry.writableArray = make([]interface{}, len(src))
 		copy(entry.writableArray, src)
 		entry.source = nil
 	}
 
-	return &entry.writableArray
+	return &entry.writableArray, nil
 }
 
-func (patcher *patcher) outputString() *string {
+func (patcher *patcher) outputString() (*string, error) {
 	entry := &patcher.outputStack[len(patcher.outputStack)-1]
 
+	if entry.writableObject != nil || entry.writableArray != nil {
+		return nil, mismatch("string on output stack", describe(entry.result()))
+	}
+
 	if entry.source != nil {
-		src := entry.source.(string)
+		src, ok := entry.source.(string)
+		if !ok {
+			return nil, mismatch("string on output stack", describe(entry.source))
+		}
 		entry.writableString = src
 		entry.source = nil
 	}
 
-	return &entry.writableString
+	return &entry.writableString, nil
+}
+
+func checkSlice(left, right, length int) error {
+	if left < 0 || left > right || right > length {
+		return mismatch(
+			fmt.Sprintf("slice [%d:%d] within bounds", left, right),
+			fmt.Sprintf("length %d", length),
+		)
+	}
+	return nil
 }
 
-func (op OpValue) applyTo(p *patcher) {
-	p.outputStack = append(p.outputStack, outputEntry{
+func (op OpValue) applyTo(p *patcher) error {
+	return p.pushOutput(outputEntry{
 		source: op.Value,
 	})
 }
 
-func (op OpCopy) applyTo(p *patcher) {
+func (op OpCopy) applyTo(p *patcher) error {
 	input := p.inputEntry()
-	p.outputStack = append(p.outputStack, outputEntry{
+	return p.pushOutput(outputEntry{
 		source: input.value,
 	})
 }
 
-func (op OpBlank) applyTo(p *patcher) {
-	p.outputStack = append(p.outputStack, outputEntry{
+func (op OpBlank) applyTo(p *patcher) error {
+	return p.pushOutput(outputEntry{
 		source: nil,
 	})
 }
 
-func (op OpReturnIntoObject) applyTo(p *patcher) {
+func (op OpReturnIntoObject) applyTo(p *patcher) error {
 	result := p.outputEntry().result()
-	p.popOutput()
-	obj := p.outputObject()
+	if err := p.popOutput(); err != nil {
+		return err
+	}
+	obj, err := p.outputObject()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(1); err != nil {
+		return err
+	}
 	obj[op.Key] = result
+	return nil
 }
 
-func (op OpReturnIntoObjectSameKey) applyTo(p *patcher) {
+func (op OpReturnIntoObjectSameKey) applyTo(p *patcher) error {
 	key := p.inputEntry().key
 	result := p.outputEntry().result()
-	p.popOutput()
-	obj := p.outputObject()
+	if err := p.popOutput(); err != nil {
+		return err
+	}
+	obj, err := p.outputObject()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(1); err != nil {
+		return err
+	}
 	obj[key] = result
+	return nil
 }
 
-func (op OpReturnIntoArray) applyTo(p *patcher) {
+func (op OpReturnIntoArray) applyTo(p *patcher) error {
 	result := p.outputEntry().result()
-	p.popOutput()
-	arr := p.outputArray()
+	if err := p.popOutput(); err != nil {
+		return err
+	}
+	arr, err := p.outputArray()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(1); err != nil {
+		return err
+	}
 	*arr = append(*arr, result)
+	return nil
 }
 
-func (op OpPushField) applyTo(p *patcher) {
-	field := p.inputEntry().getField(op.Index)
-	value := field.value
-	if p.options.convertFunc != nil {
-		value = p.options.convertFunc(value)
+func (op OpPushField) applyTo(p *patcher) error {
+	field, err := p.inputEntry().getField(op.Index)
+	if err != nil {
+		return err
 	}
-	p.inputStack = append(p.inputStack, inputEntry{
-		key:   field.key,
-		value: value,
-	})
+	value, err := mendoza.Convert(field.value, p.options.convertFunc)
+	if err != nil {
+		return err
+	}
+	return p.pushChild(field.key, value, op.Index)
 }
 
-func (op OpPushElement) applyTo(p *patcher) {
-	value := p.inputArray()[op.Index]
-	if p.options.convertFunc != nil {
-		value = p.options.convertFunc(value)
+func (op OpPushElement) applyTo(p *patcher) error {
+	arr, err := p.inputArray()
+	if err != nil {
+		return err
 	}
-	p.inputStack = append(p.inputStack, inputEntry{
-		value: value,
-	})
+	if op.Index < 0 || op.Index >= len(arr) {
+		return mismatch(
+			fmt.Sprintf("element index %d on input stack", op.Index),
+			fmt.Sprintf("array with %d elements", len(arr)),
+		)
+	}
+	value, err := mendoza.Convert(arr[op.Index], p.options.convertFunc)
+	if err != nil {
+		return err
+	}
+	return p.pushChild("", value, op.Index)
 }
 
-func (op OpPushParent) applyTo(p *patcher) {
+func (op OpPushParent) applyTo(p *patcher) error {
 	idx := len(p.inputStack) - 2 - op.N
-	entry := p.inputStack[idx]
-	p.inputStack = append(p.inputStack, entry)
+	if op.N < 0 || idx < 0 {
+		return mismatch(
+			fmt.Sprintf("parent %d on input stack", op.N),
+			fmt.Sprintf("input stack of depth %d", len(p.inputStack)),
+		)
+	}
+	return p.pushInput(p.inputStack[idx])
 }
 
-func (op OpPop) applyTo(p *patcher) {
-	p.popInput()
+func (op OpPop) applyTo(p *patcher) error {
+	return p.popInput()
 }
 
-func (op OpPushFieldCopy) applyTo(p *patcher) {
-	op.OpPushField.applyTo(p)
-	op.OpCopy.applyTo(p)
+func (op OpPushFieldCopy) applyTo(p *patcher) error {
+	if err := op.OpPushField.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpCopy.applyTo(p)
 }
 
-func (op OpPushFieldBlank) applyTo(p *patcher) {
-	op.OpPushField.applyTo(p)
-	op.OpBlank.applyTo(p)
+func (op OpPushFieldBlank) applyTo(p *patcher) error {
+	if err := op.OpPushField.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpBlank.applyTo(p)
 }
 
-func (op OpPushElementCopy) applyTo(p *patcher) {
-	op.OpPushElement.applyTo(p)
-	op.OpCopy.applyTo(p)
+func (op OpPushElementCopy) applyTo(p *patcher) error {
+	if err := op.OpPushElement.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpCopy.applyTo(p)
 }
 
-func (op OpPushElementBlank) applyTo(p *patcher) {
-	op.OpPushElement.applyTo(p)
-	op.OpBlank.applyTo(p)
+func (op OpPushElementBlank) applyTo(p *patcher) error {
+	if err := op.OpPushElement.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpBlank.applyTo(p)
 }
 
-func (op OpReturnIntoObjectPop) applyTo(p *patcher) {
-	op.OpReturnIntoObject.applyTo(p)
-	op.OpPop.applyTo(p)
+func (op OpReturnIntoObjectPop) applyTo(p *patcher) error {
+	if err := op.OpReturnIntoObject.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpPop.applyTo(p)
 }
 
-func (op OpReturnIntoObjectSameKeyPop) applyTo(p *patcher) {
-	op.OpReturnIntoObjectSameKey.applyTo(p)
-	op.OpPop.applyTo(p)
+func (op OpReturnIntoObjectSameKeyPop) applyTo(p *patcher) error {
+	if err := op.OpReturnIntoObjectSameKey.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpPop.applyTo(p)
 }
 
-func (op OpReturnIntoArrayPop) applyTo(p *patcher) {
-	op.OpReturnIntoArray.applyTo(p)
-	op.OpPop.applyTo(p)
+func (op OpReturnIntoArrayPop) applyTo(p *patcher) error {
+	if err := op.OpReturnIntoArray.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpPop.applyTo(p)
 }
 
-func (op OpObjectSetFieldValue) applyTo(p *patcher) {
-	op.OpValue.applyTo(p)
-	op.OpReturnIntoObject.applyTo(p)
+func (op OpObjectSetFieldValue) applyTo(p *patcher) error {
+	if err := op.OpValue.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpReturnIntoObject.applyTo(p)
 }
 
-func (op OpObjectCopyField) applyTo(p *patcher) {
-	op.OpPushField.applyTo(p)
-	op.OpCopy.applyTo(p)
-	op.OpReturnIntoObjectSameKey.applyTo(p)
-	op.OpPop.applyTo(p)
+func (op OpObjectCopyField) applyTo(p *patcher) error {
+	if err := op.OpPushField.applyTo(p); err != nil {
+		return err
+	}
+	if err := op.OpCopy.applyTo(p); err != nil {
+		return err
+	}
+	if err := op.OpReturnIntoObjectSameKey.applyTo(p); err != nil {
+		return err
+	}
+	return op.OpPop.applyTo(p)
 }
 
-func (op OpObjectDeleteField) applyTo(p *patcher) {
-	field := p.inputEntry().getField(op.Index)
-	obj := p.outputObject()
+func (op OpObjectDeleteField) applyTo(p *patcher) error {
+	field, err := p.inputEntry().getField(op.Index)
+	if err != nil {
+		return err
+	}
+	obj, err := p.outputObject()
+	if err != nil {
+		return err
+	}
 	delete(obj, field.key)
+	return nil
 }
 
-func (op OpArrayAppendValue) applyTo(p *patcher) {
-	arr := p.outputArray()
+func (op OpArrayAppendValue) applyTo(p *patcher) error {
+	arr, err := p.outputArray()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(1); err != nil {
+		return err
+	}
 	*arr = append(*arr, op.Value)
+	return nil
 }
 
-func (op OpArrayAppendSlice) applyTo(p *patcher) {
-	src := p.inputArray()
-	arr := p.outputArray()
+func (op OpArrayAppendSlice) applyTo(p *patcher) error {
+	src, err := p.inputArray()
+	if err != nil {
+		return err
+	}
+	if err := checkSlice(op.Left, op.Right, len(src)); err != nil {
+		return err
+	}
+	arr, err := p.outputArray()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(op.Right - op.Left); err != nil {
+		return err
+	}
 	*arr = append(*arr, src[op.Left:op.Right]...)
+	return nil
 }
 
-func (op OpStringAppendString) applyTo(p *patcher) {
-	str := p.outputString()
+func (op OpStringAppendString) applyTo(p *patcher) error {
+	str, err := p.outputString()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(len(op.String)); err != nil {
+		return err
+	}
 	*str = *str + op.String
+	return nil
 }
 
-func (op OpStringAppendSlice) applyTo(p *patcher) {
-	src := p.inputString()
-	str := p.outputString()
+func (op OpStringAppendSlice) applyTo(p *patcher) error {
+	src, err := p.inputString()
+	if err != nil {
+		return err
+	}
+	if err := checkSlice(op.Left, op.Right, len(src)); err != nil {
+		return err
+	}
+	str, err := p.outputString()
+	if err != nil {
+		return err
+	}
+	if err := p.grow(op.Right - op.Left); err != nil {
+		return err
+	}
 	*str = *str + src[op.Left:op.Right]
+	return nil
+}
+
+func (op OpAssertFingerprint) applyTo(p *patcher) error {
+	hash, err := p.inputHash()
+	if err != nil {
+		return err
+	}
+	if Fingerprint(hash) != op.Fingerprint {
+		return ErrBaseMismatch
+	}
+	return nil
+}
+
+// inputHash returns the hash of the current input value. The root is only hashed once, so
+// asserting the fingerprint of any value in the document doesn't require hashing it again.
+func (patcher *patcher) inputHash() (mendoza.Hash, error) {
+	if patcher.hashList == nil {
+		hashList, err := mendoza.HashListFor(patcher.inputStack[0].value, patcher.options.convertFunc)
+		if err != nil {
+			return mendoza.Hash{}, err
+		}
+		patcher.hashList = hashList
+		patcher.children = make(map[int][]int)
+	}
+
+	idx, ok := patcher.hashIndex(len(patcher.inputStack) - 1)
+	if !ok {
+		// This only happens if the convert function doesn't return the same value every time.
+		hashList, err := mendoza.HashListFor(patcher.inputEntry().value, patcher.options.convertFunc)
+		if err != nil {
+			return mendoza.Hash{}, err
+		}
+		return hashList.Entries[0].Hash, nil
+	}
+	return patcher.hashList.Entries[idx].Hash, nil
+}
+
+// hashIndex finds the entry in the hash list for a value on the input stack.
+func (patcher *patcher) hashIndex(stackIdx int) (int, bool) {
+	entry := &patcher.inputStack[stackIdx]
+	if entry.hashIdx < 0 {
+		parentIdx, ok := patcher.hashIndex(entry.parent)
+		if !ok {
+			return 0, false
+		}
+		children, ok := patcher.children[parentIdx]
+		if !ok {
+			parent := &patcher.hashList.Entries[parentIdx]
+			if parent.IsNonEmptyMap() || parent.IsNonEmptySlice() {
+				for it := patcher.hashList.Iter(parentIdx); !it.IsDone(); it.Next() {
+					children = append(children, it.GetIndex())
+				}
+			}
+			patcher.children[parentIdx] = children
+		}
+		if entry.index >= len(children) {
+			return 0, false
+		}
+		entry.hashIdx = children[entry.index]
+	}
+	return entry.hashIdx, true
 }
@@ -0,0 +1,89 @@
+package mendoza_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryApplyPatchMismatch(t *testing.T) {
+	var left, right, other interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "abcdef", "b": [1, 2, 3], "c": {"d": true}}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "abcxyzdef", "b": [3, 1, 2], "c": {"d": false}}`), &right))
+	require.NoError(t, json.Unmarshal([]byte(`[1, "two", null]`), &other))
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	result, err := mendoza.TryApplyPatch(left, patch)
+	require.NoError(t, err)
+	require.EqualValues(t, right, result)
+
+	for _, doc := range []interface{}{other, nil, "abc", 1.0, map[string]interface{}{}} {
+		require.NotPanics(t, func() {
+			_, err = mendoza.TryApplyPatch(doc, patch)
+		})
+		require.Error(t, err)
+		require.IsType(t, &mendoza.ApplyError{}, err)
+	}
+}
+
+func TestTryApplyPatchErrorDetails(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpPushFieldCopy{OpPushField: mendoza.OpPushField{Index: 0}},
+		&mendoza.OpArrayAppendSlice{Left: 0, Right: 10},
+	}
+
+	_, err := mendoza.TryApplyPatch(map[string]interface{}{"a": []interface{}{1.0}}, patch)
+	require.Error(t, err)
+
+	applyErr := err.(*mendoza.ApplyError)
+	require.Equal(t, 1, applyErr.Index)
+	require.Equal(t, patch[1], applyErr.Op)
+	require.Equal(t, "length 1", applyErr.Found)
+
+	_, err = mendoza.TryApplyPatch(map[string]interface{}{}, mendoza.Patch{&mendoza.OpPop{}})
+	require.Error(t, err)
+	require.Equal(t, 0, err.(*mendoza.ApplyError).Index)
+
+	require.Panics(t, func() {
+		mendoza.ApplyPatch("abc", patch)
+	})
+}
+
+func TestApplyPatchFromReader(t *testing.T) {
+	var left, right interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "abcdef", "b": [1, 2, 3], "c": {"d": true}}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "abcxyzdef", "b": [3, 1, 2], "e": {"d": false}}`), &right))
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(patch)
+	require.NoError(t, err)
+
+	result, err := mendoza.ApplyPatchFromReader(left, mendoza.NewDecoder(bytes.NewReader(data)))
+	require.NoError(t, err)
+	require.Equal(t, right, result)
+
+	t.Run("Empty", func(t *testing.T) {
+		result, err := mendoza.ApplyPatchFromReader(left, mendoza.NewDecoder(strings.NewReader(`[]`)))
+		require.NoError(t, err)
+		require.Equal(t, left, result)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		_, err := mendoza.ApplyPatchFromReader("abc", mendoza.NewDecoder(bytes.NewReader(data)))
+		require.IsType(t, &mendoza.ApplyError{}, err)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		// The first operation is applied before the unknown opcode is found.
+		_, err := mendoza.ApplyPatchFromReader(left, mendoza.NewDecoder(strings.NewReader(`[19,0,255]`)))
+		require.EqualError(t, err, "unknown opcode: 255")
+	})
+}
@@ -0,0 +1,35 @@
+package mendoza
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Path identifies a value inside a document. Every element is either a string (a key in
+// an object) or an int (an index in an array).
+type Path []interface{}
+
+// String returns the path as a JSON Pointer (RFC 6901), e.g. "/users/0/name".
+func (path Path) String() string {
+	var sb strings.Builder
+	for _, elem := range path {
+		sb.WriteByte('/')
+		switch elem := elem.(type) {
+		case string:
+			sb.WriteString(pointerEscaper.Replace(elem))
+		case int:
+			sb.WriteString(strconv.Itoa(elem))
+		}
+	}
+	return sb.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// child returns a new path with elem appended. The original path is never modified.
+func (path Path) child(elem interface{}) Path {
+	result := make(Path, len(path)+1)
+	copy(result, path)
+	result[len(path)] = elem
+	return result
+}
@@ -0,0 +1,367 @@
+// Package mendozabin implements a compact binary encoding of Mendoza patches without any external dependencies.
+//
+// Opcodes, indices and lengths are encoded as unsigned varints (as in encoding/binary) and strings are
+// prefixed with their length. Values (e.g. in OpValue) are encoded with a tag byte followed by the contents:
+//
+//	0  null
+//	1  false
+//	2  true
+//	3  float64: 8 bytes, big endian IEEE 754
+//	4  float32: 4 bytes, big endian IEEE 754
+//	5  signed integer: varint
+//	6  unsigned integer: unsigned varint
+//	7  json.Number: length-prefixed decimal string
+//	8  string: length-prefixed
+//	9  array: length followed by the elements
+//	10 object: length followed by key/value pairs
+//
+// Object keys are sorted so equal patches produce equal bytes.
+package mendozabin
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/sanity-io/mendoza"
+)
+
+const (
+	tagNull uint8 = iota
+	tagFalse
+	tagTrue
+	tagFloat64
+	tagFloat32
+	tagInt
+	tagUint
+	tagNumber
+	tagString
+	tagArray
+	tagObject
+)
+
+// Maximum nesting of arrays/objects accepted by the decoder.
+const maxNesting = 10000
+
+var errTooDeep = errors.New("mendozabin: value nested too deeply")
+
+// Marshal encodes a Mendoza patch using the binary format.
+func Marshal(patch mendoza.Patch) ([]byte, error) {
+	w := &writer{buf: []byte{}}
+	for _, op := range patch {
+		err := mendoza.WriteTo(w, op)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w.buf, nil
+}
+
+// Unmarshal decodes a Mendoza patch using the binary format.
+func Unmarshal(data []byte) (mendoza.Patch, error) {
+	return UnmarshalWithOptions(data, mendoza.DecodeOptions{})
+}
+
+// UnmarshalWithOptions decodes a Mendoza patch using the binary format,
+// returning a *mendoza.LimitError if the patch exceeds any of the limits.
+func UnmarshalWithOptions(data []byte, opts mendoza.DecodeOptions) (mendoza.Patch, error) {
+	return opts.ReadPatch(&reader{data: data})
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) writeUvarint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	w.buf = append(w.buf, tmp[:n]...)
+}
+
+func (w *writer) writeVarint(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	w.buf = append(w.buf, tmp[:n]...)
+}
+
+func (w *writer) WriteUint8(v uint8) error {
+	w.writeUvarint(uint64(v))
+	return nil
+}
+
+func (w *writer) WriteUint(v int) error {
+	if v < 0 {
+		return fmt.Errorf("mendozabin: negative integer %d", v)
+	}
+	w.writeUvarint(uint64(v))
+	return nil
+}
+
+func (w *writer) WriteString(v string) error {
+	w.writeUvarint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+	return nil
+}
+
+func (w *writer) WriteValue(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.buf = append(w.buf, tagNull)
+	case bool:
+		if v {
+			w.buf = append(w.buf, tagTrue)
+		} else {
+			w.buf = append(w.buf, tagFalse)
+		}
+	case float64:
+		var tmp [8]byte
+		binary.BigEndian.PutUint64(tmp[:], math.Float64bits(v))
+		w.buf = append(w.buf, tagFloat64)
+		w.buf = append(w.buf, tmp[:]...)
+	case float32:
+		var tmp [4]byte
+		binary.BigEndian.PutUint32(tmp[:], math.Float32bits(v))
+		w.buf = append(w.buf, tagFloat32)
+		w.buf = append(w.buf, tmp[:]...)
+	case int:
+		w.writeInt(int64(v))
+	case int8:
+		w.writeInt(int64(v))
+	case int16:
+		w.writeInt(int64(v))
+	case int32:
+		w.writeInt(int64(v))
+	case int64:
+		w.writeInt(v)
+	case uint:
+		w.writeUint(uint64(v))
+	case uint8:
+		w.writeUint(uint64(v))
+	case uint16:
+		w.writeUint(uint64(v))
+	case uint32:
+		w.writeUint(uint64(v))
+	case uint64:
+		w.writeUint(v)
+	case json.Number:
+		w.buf = append(w.buf, tagNumber)
+		return w.WriteString(string(v))
+	case string:
+		w.buf = append(w.buf, tagString)
+		return w.WriteString(v)
+	case []interface{}:
+		w.buf = append(w.buf, tagArray)
+		w.writeUvarint(uint64(len(v)))
+		for _, item := range v {
+			err := w.WriteValue(item)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		w.buf = append(w.buf, tagObject)
+		w.writeUvarint(uint64(len(v)))
+		for _, key := range keys {
+			err := w.WriteString(key)
+			if err != nil {
+				return err
+			}
+			err = w.WriteValue(v[key])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("mendozabin: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (w *writer) writeInt(v int64) {
+	w.buf = append(w.buf, tagInt)
+	w.writeVarint(v)
+}
+
+func (w *writer) writeUint(v uint64) {
+	w.buf = append(w.buf, tagUint)
+	w.writeUvarint(v)
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) readUvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if n < 0 {
+		return 0, errors.New("mendozabin: varint overflows 64 bits")
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *reader) readVarint() (int64, error) {
+	v, n := binary.Varint(r.data[r.pos:])
+	if n == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if n < 0 {
+		return 0, errors.New("mendozabin: varint overflows 64 bits")
+	}
+	r.pos += n
+	return v, nil
+}
+
+// readLength reads a length and verifies that the data contains at least that many bytes.
+func (r *reader) readLength() (int, error) {
+	v, err := r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(len(r.data)-r.pos) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(v), nil
+}
+
+func (r *reader) readBytes(n int) ([]byte, error) {
+	if n > len(r.data)-r.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) ReadUint8() (uint8, error) {
+	if r.pos == len(r.data) {
+		return 0, io.EOF
+	}
+	v, err := r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxUint8 {
+		return 0, fmt.Errorf("mendozabin: invalid opcode %d", v)
+	}
+	return uint8(v), nil
+}
+
+func (r *reader) ReadUint() (int, error) {
+	v, err := r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(^uint(0)>>1) {
+		return 0, fmt.Errorf("mendozabin: integer %d out of range", v)
+	}
+	return int(v), nil
+}
+
+func (r *reader) ReadString() (string, error) {
+	n, err := r.readLength()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.readBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r *reader) ReadValue() (interface{}, error) {
+	return r.readValue(0)
+}
+
+func (r *reader) readValue(depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, errTooDeep
+	}
+
+	tag, err := r.readBytes(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag[0] {
+	case tagNull:
+		return nil, nil
+	case tagFalse:
+		return false, nil
+	case tagTrue:
+		return true, nil
+	case tagFloat64:
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case tagFloat32:
+		b, err := r.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case tagInt:
+		return r.readVarint()
+	case tagUint:
+		return r.readUvarint()
+	case tagNumber:
+		s, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(s), nil
+	case tagString:
+		return r.ReadString()
+	case tagArray:
+		// Every element takes at least one byte so readLength also bounds the number of elements.
+		n, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, n)
+		for i := range result {
+			result[i], err = r.readValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case tagObject:
+		// Every field takes at least two bytes so readLength also bounds the number of fields.
+		n, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, err := r.ReadString()
+			if err != nil {
+				return nil, err
+			}
+			result[key], err = r.readValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("mendozabin: unknown value tag %d", tag[0])
+}
@@ -0,0 +1,143 @@
+package mendozabin_test
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/sanity-io/mendoza/pkg/mendozabin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodingSize(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpBlank{},
+		&mendoza.OpArrayAppendSlice{Left: 0, Right: 6},
+	}
+
+	b, err := mendozabin.Marshal(patch)
+	require.NoError(t, err)
+	require.Len(t, b, 4)
+}
+
+func TestRoundtrip(t *testing.T) {
+	// This patch isn't valid, we're only testing that it roundtrips properly
+	patch := mendoza.Patch{
+		&mendoza.OpBlank{},
+		&mendoza.OpPushFieldCopy{OpPushField: mendoza.OpPushField{Index: 10}},
+		&mendoza.OpPushElement{Index: 1000000},
+		&mendoza.OpValue{Value: "abc"},
+		&mendoza.OpArrayAppendSlice{Left: 0, Right: 6},
+		&mendoza.OpObjectSetFieldValue{
+			OpValue:            mendoza.OpValue{Value: map[string]interface{}{"a": []interface{}{nil, true, false, 1.5}}},
+			OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "key"},
+		},
+		&mendoza.OpStringAppendString{String: "ünïcødé"},
+	}
+
+	b, err := mendozabin.Marshal(patch)
+	require.NoError(t, err)
+
+	decodedPatch, err := mendozabin.Unmarshal(b)
+	require.NoError(t, err)
+
+	require.EqualValues(t, patch, decodedPatch)
+}
+
+func TestSize(t *testing.T) {
+	left := map[string]interface{}{
+		"_type": "Person",
+		"name":  "Bob",
+		"age":   10.0,
+	}
+	right := map[string]interface{}{
+		"_type": "Person",
+		"name":  "Bob",
+		"age":   15.0,
+	}
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	b, err := mendozabin.Marshal(patch)
+	require.NoError(t, err)
+	require.True(t, len(b) < 20)
+}
+
+func TestEmptyPatch(t *testing.T) {
+	b, err := mendozabin.Marshal(mendoza.Patch{})
+	require.NoError(t, err)
+	require.NotNil(t, b)
+
+	patch, err := mendozabin.Unmarshal(b)
+	require.NoError(t, err)
+	require.Empty(t, patch)
+}
+
+func TestNumbers(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpValue{Value: []interface{}{
+			json.Number("123456789012345678901234567890"),
+			int64(-5),
+			uint64(18446744073709551615),
+			float32(1.5),
+			1.25,
+		}},
+	}
+
+	b, err := mendozabin.Marshal(patch)
+	require.NoError(t, err)
+
+	decodedPatch, err := mendozabin.Unmarshal(b)
+	require.NoError(t, err)
+	require.Equal(t, patch, decodedPatch)
+
+	b, err = mendozabin.Marshal(mendoza.Patch{&mendoza.OpValue{Value: []interface{}{1, uint8(2)}}})
+	require.NoError(t, err)
+
+	decodedPatch, err = mendozabin.Unmarshal(b)
+	require.NoError(t, err)
+	require.Equal(t, mendoza.Patch{&mendoza.OpValue{Value: []interface{}{int64(1), uint64(2)}}}, decodedPatch)
+}
+
+func TestDeterministic(t *testing.T) {
+	value := map[string]interface{}{}
+	for _, key := range []string{"d", "b", "a", "c", "e", "f", "g", "h"} {
+		value[key] = key
+	}
+
+	first, err := mendozabin.Marshal(mendoza.Patch{&mendoza.OpValue{Value: value}})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		b, err := mendozabin.Marshal(mendoza.Patch{&mendoza.OpValue{Value: value}})
+		require.NoError(t, err)
+		require.Equal(t, first, b)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	b, err := mendozabin.Marshal(mendoza.Patch{
+		&mendoza.OpObjectSetFieldValue{
+			OpValue:            mendoza.OpValue{Value: map[string]interface{}{"abc": "def"}},
+			OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "key"},
+		},
+	})
+	require.NoError(t, err)
+
+	for i := 1; i < len(b); i++ {
+		_, err := mendozabin.Unmarshal(b[:i])
+		require.Equal(t, io.ErrUnexpectedEOF, err, "truncated at %d", i)
+	}
+
+	_, err = mendozabin.Unmarshal([]byte{200, 1})
+	require.Error(t, err)
+
+	// Array which claims to have more elements than there are bytes.
+	_, err = mendozabin.Unmarshal([]byte{0, 9, 0xff, 0xff, 0xff, 0xff, 0x0f})
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = mendozabin.Marshal(mendoza.Patch{&mendoza.OpValue{Value: struct{}{}}})
+	require.Error(t, err)
+}
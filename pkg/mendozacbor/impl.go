@@ -0,0 +1,720 @@
+// Package mendozacbor implements encoding of Mendoza patches using CBOR (RFC 8949).
+//
+// A patch is encoded as a single array with the same layout as the JSON representation
+// (every opcode followed by its parameters). The encoding is deterministic (see section 4.2
+// of RFC 8949): Integers and lengths use the shortest form, floats use the shortest form which
+// preserves the value, and object keys are sorted. Equal patches therefore produce equal bytes.
+//
+// Integers outside the 64-bit range (json.Number) are encoded as bignums and decoded as json.Number.
+// Decimals (json.Number) which aren't exactly a float64 are encoded as decimal fractions (tag 4) and
+// decoded as json.Number in exponent notation. Floats are always decoded as float64.
+package mendozacbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sanity-io/mendoza"
+	internal "github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+const (
+	majorUint   byte = 0
+	majorNegInt byte = 1
+	majorBytes  byte = 2
+	majorText   byte = 3
+	majorArray  byte = 4
+	majorMap    byte = 5
+	majorTag    byte = 6
+	majorSimple byte = 7
+)
+
+const (
+	tagPositiveBignum  = 2
+	tagNegativeBignum  = 3
+	tagDecimalFraction = 4
+)
+
+const (
+	simpleFalse     = 20
+	simpleTrue      = 21
+	simpleNull      = 22
+	simpleUndefined = 23
+	simpleFloat16   = 25
+	simpleFloat32   = 26
+	simpleFloat64   = 27
+)
+
+// Maximum nesting of arrays/objects accepted by the decoder.
+const maxNesting = 10000
+
+// CBORPatch is an alias for mendoza.Patch which implements MarshalCBOR/UnmarshalCBOR.
+// You should only use this if you need to embed a patch inside a larger CBOR structure
+// (these methods are recognized by common CBOR libraries). Otherwise it's preferred to
+// use the Marshal and Unmarshal functions.
+type CBORPatch mendoza.Patch
+
+// MarshalCBOR encodes the patch as a single CBOR array.
+func (patch CBORPatch) MarshalCBOR() ([]byte, error) {
+	return Marshal(mendoza.Patch(patch))
+}
+
+// UnmarshalCBOR decodes the patch from a single CBOR array.
+func (patch *CBORPatch) UnmarshalCBOR(data []byte) error {
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	*patch = CBORPatch(decoded)
+	return nil
+}
+
+// Marshal encodes a Mendoza patch using CBOR.
+func Marshal(patch mendoza.Patch) ([]byte, error) {
+	body := &writer{}
+	for _, op := range patch {
+		err := mendoza.WriteTo(body, op)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w := &writer{}
+	w.head(majorArray, uint64(body.items))
+	w.buf.Write(body.buf.Bytes())
+	return w.buf.Bytes(), nil
+}
+
+// Unmarshal decodes a Mendoza patch using CBOR.
+func Unmarshal(data []byte) (mendoza.Patch, error) {
+	return UnmarshalWithOptions(data, mendoza.DecodeOptions{})
+}
+
+// UnmarshalWithOptions decodes a Mendoza patch using CBOR,
+// returning a *mendoza.LimitError if the patch exceeds any of the limits.
+func UnmarshalWithOptions(data []byte, opts mendoza.DecodeOptions) (mendoza.Patch, error) {
+	r := &reader{data: data}
+
+	major, _, count, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != majorArray {
+		return nil, errors.New("mendozacbor: expected array")
+	}
+	if count > uint64(len(data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r.remaining = int(count)
+
+	patch, err := opts.ReadPatch(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.pos != len(data) {
+		return nil, errors.New("mendozacbor: unexpected data after patch")
+	}
+
+	return patch, nil
+}
+
+// writer encodes items and keeps track of how many top-level items have been written.
+type writer struct {
+	buf   bytes.Buffer
+	items int
+}
+
+// head writes the initial byte(s) of an item using the shortest possible encoding of the argument.
+func (w *writer) head(major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		w.buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		w.buf.WriteByte(major | 24)
+		w.buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		var tmp [2]byte
+		binary.BigEndian.PutUint16(tmp[:], uint16(arg))
+		w.buf.WriteByte(major | 25)
+		w.buf.Write(tmp[:])
+	case arg <= math.MaxUint32:
+		var tmp [4]byte
+		binary.BigEndian.PutUint32(tmp[:], uint32(arg))
+		w.buf.WriteByte(major | 26)
+		w.buf.Write(tmp[:])
+	default:
+		var tmp [8]byte
+		binary.BigEndian.PutUint64(tmp[:], arg)
+		w.buf.WriteByte(major | 27)
+		w.buf.Write(tmp[:])
+	}
+}
+
+func (w *writer) WriteUint8(v uint8) error {
+	w.items++
+	w.head(majorUint, uint64(v))
+	return nil
+}
+
+func (w *writer) WriteUint(v int) error {
+	if v < 0 {
+		return fmt.Errorf("mendozacbor: negative integer %d", v)
+	}
+	w.items++
+	w.head(majorUint, uint64(v))
+	return nil
+}
+
+func (w *writer) WriteString(v string) error {
+	w.items++
+	w.text(v)
+	return nil
+}
+
+func (w *writer) WriteValue(v interface{}) error {
+	w.items++
+	return w.value(v)
+}
+
+func (w *writer) text(v string) {
+	w.head(majorText, uint64(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *writer) int(v int64) {
+	if v < 0 {
+		w.head(majorNegInt, uint64(-1-v))
+	} else {
+		w.head(majorUint, uint64(v))
+	}
+}
+
+func (w *writer) value(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.head(majorSimple, simpleNull)
+	case bool:
+		if v {
+			w.head(majorSimple, simpleTrue)
+		} else {
+			w.head(majorSimple, simpleFalse)
+		}
+	case float64:
+		w.float(v)
+	case float32:
+		w.float(float64(v))
+	case int:
+		w.int(int64(v))
+	case int8:
+		w.int(int64(v))
+	case int16:
+		w.int(int64(v))
+	case int32:
+		w.int(int64(v))
+	case int64:
+		w.int(v)
+	case uint:
+		w.head(majorUint, uint64(v))
+	case uint8:
+		w.head(majorUint, uint64(v))
+	case uint16:
+		w.head(majorUint, uint64(v))
+	case uint32:
+		w.head(majorUint, uint64(v))
+	case uint64:
+		w.head(majorUint, v)
+	case json.Number:
+		return w.number(v)
+	case string:
+		w.text(v)
+	case []interface{}:
+		w.head(majorArray, uint64(len(v)))
+		for _, item := range v {
+			err := w.value(item)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// Sorting by length first gives the bytewise order of the encoded keys.
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+
+		w.head(majorMap, uint64(len(v)))
+		for _, key := range keys {
+			w.text(key)
+			err := w.value(v[key])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("mendozacbor: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (w *writer) number(v json.Number) error {
+	s := string(v)
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		w.int(i)
+		return nil
+	}
+
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		w.head(majorUint, u)
+		return nil
+	}
+
+	if strings.ContainsAny(s, ".eE") {
+		if f, ok := internal.NumberFloat64(s); ok {
+			w.float(f)
+			return nil
+		}
+
+		mantissa, exp, ok := internal.NumberDecimal(s)
+		if !ok {
+			return fmt.Errorf("mendozacbor: invalid number %s", s)
+		}
+		w.head(majorTag, tagDecimalFraction)
+		w.head(majorArray, 2)
+		w.int(int64(exp))
+		w.bigint(mantissa)
+		return nil
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return fmt.Errorf("mendozacbor: invalid number %s", s)
+	}
+	w.bigint(n)
+	return nil
+}
+
+// bigint writes an integer, using a bignum only if it doesn't fit in a regular integer.
+func (w *writer) bigint(n *big.Int) {
+	if n.IsInt64() {
+		w.int(n.Int64())
+		return
+	}
+
+	if n.IsUint64() {
+		w.head(majorUint, n.Uint64())
+		return
+	}
+
+	if n.Sign() < 0 {
+		n = new(big.Int).Neg(n)
+		n.Sub(n, big.NewInt(1))
+		if n.IsUint64() {
+			w.head(majorNegInt, n.Uint64())
+			return
+		}
+		w.head(majorTag, tagNegativeBignum)
+	} else {
+		w.head(majorTag, tagPositiveBignum)
+	}
+
+	b := n.Bytes()
+	w.head(majorBytes, uint64(len(b)))
+	w.buf.Write(b)
+}
+
+// float writes a float using the shortest encoding which preserves the value.
+func (w *writer) float(v float64) {
+	if math.IsNaN(v) {
+		w.buf.Write([]byte{majorSimple<<5 | simpleFloat16, 0x7e, 0x00})
+		return
+	}
+
+	f32 := float32(v)
+	if float64(f32) != v {
+		var tmp [8]byte
+		binary.BigEndian.PutUint64(tmp[:], math.Float64bits(v))
+		w.buf.WriteByte(majorSimple<<5 | simpleFloat64)
+		w.buf.Write(tmp[:])
+		return
+	}
+
+	if half, ok := toFloat16(f32); ok {
+		var tmp [2]byte
+		binary.BigEndian.PutUint16(tmp[:], half)
+		w.buf.WriteByte(majorSimple<<5 | simpleFloat16)
+		w.buf.Write(tmp[:])
+		return
+	}
+
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], math.Float32bits(f32))
+	w.buf.WriteByte(majorSimple<<5 | simpleFloat32)
+	w.buf.Write(tmp[:])
+}
+
+// toFloat16 converts a (non-NaN) float32 into a half-precision float if it can be done without losing precision.
+func toFloat16(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff:
+		// Infinity
+		return sign | 0x7c00, true
+	case exp == 0 && mant == 0:
+		return sign, true
+	}
+
+	e := exp - 127
+
+	if e >= -14 && e <= 15 {
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(e+15)<<10 | uint16(mant>>13), true
+	}
+
+	if e >= -24 && e < -14 {
+		// Subnormal
+		full := mant | 0x800000
+		shift := uint(-1 - e)
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+
+	return 0, false
+}
+
+func fromFloat16(half uint16) float64 {
+	exp := int(half>>10) & 0x1f
+	mant := int(half & 0x3ff)
+
+	var result float64
+	switch exp {
+	case 0:
+		result = math.Ldexp(float64(mant), -24)
+	case 0x1f:
+		if mant != 0 {
+			return math.NaN()
+		}
+		result = math.Inf(1)
+	default:
+		result = math.Ldexp(float64(mant|0x400), exp-25)
+	}
+
+	if half&0x8000 != 0 {
+		return -result
+	}
+	return result
+}
+
+// reader decodes items from the top-level array. remaining is the number of items left in the array.
+type reader struct {
+	data      []byte
+	pos       int
+	remaining int
+}
+
+func (r *reader) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// head reads the initial byte(s) of an item and returns the major type, the additional information and the argument.
+func (r *reader) head() (major byte, info byte, arg uint64, err error) {
+	b, err := r.readBytes(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major = b[0] >> 5
+	info = b[0] & 0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		b, err := r.readBytes(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	}
+
+	// Indefinite lengths are not used by the deterministic encoding.
+	return 0, 0, 0, fmt.Errorf("mendozacbor: unsupported additional information %d", info)
+}
+
+// next is invoked before reading a top-level item.
+func (r *reader) next() error {
+	if r.remaining == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	r.remaining--
+	return nil
+}
+
+func (r *reader) uint() (uint64, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorUint {
+		return 0, errors.New("mendozacbor: expected unsigned integer")
+	}
+	return arg, nil
+}
+
+func (r *reader) ReadUint8() (uint8, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	r.remaining--
+
+	v, err := r.uint()
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxUint8 {
+		return 0, fmt.Errorf("mendozacbor: invalid opcode %d", v)
+	}
+	return uint8(v), nil
+}
+
+func (r *reader) ReadUint() (int, error) {
+	if err := r.next(); err != nil {
+		return 0, err
+	}
+
+	v, err := r.uint()
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(^uint(0)>>1) {
+		return 0, fmt.Errorf("mendozacbor: integer %d out of range", v)
+	}
+	return int(v), nil
+}
+
+func (r *reader) ReadString() (string, error) {
+	if err := r.next(); err != nil {
+		return "", err
+	}
+
+	major, _, arg, err := r.head()
+	if err != nil {
+		return "", err
+	}
+	if major != majorText {
+		return "", errors.New("mendozacbor: expected text string")
+	}
+	return r.text(arg)
+}
+
+func (r *reader) ReadValue() (interface{}, error) {
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r.value(0)
+}
+
+func (r *reader) text(length uint64) (string, error) {
+	b, err := r.readBytes(length)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errors.New("mendozacbor: invalid UTF-8 in text string")
+	}
+	return string(b), nil
+}
+
+// bignum reads the byte string of a bignum with the given tag.
+func (r *reader) bignum(tag uint64) (*big.Int, error) {
+	major, _, length, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != majorBytes {
+		return nil, errors.New("mendozacbor: expected byte string in bignum")
+	}
+	b, err := r.readBytes(length)
+	if err != nil {
+		return nil, err
+	}
+	n := new(big.Int).SetBytes(b)
+	if tag == tagNegativeBignum {
+		n.Neg(n).Sub(n, big.NewInt(1))
+	}
+	return n, nil
+}
+
+// integer reads an integer or a bignum.
+func (r *reader) integer() (*big.Int, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case major == majorUint:
+		return new(big.Int).SetUint64(arg), nil
+	case major == majorNegInt:
+		n := new(big.Int).SetUint64(arg)
+		return n.Neg(n).Sub(n, big.NewInt(1)), nil
+	case major == majorTag && (arg == tagPositiveBignum || arg == tagNegativeBignum):
+		return r.bignum(arg)
+	default:
+		return nil, errors.New("mendozacbor: expected integer")
+	}
+}
+
+// decimalFraction reads the content of a decimal fraction (tag 4) as a json.Number.
+func (r *reader) decimalFraction() (interface{}, error) {
+	major, _, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != majorArray || arg != 2 {
+		return nil, errors.New("mendozacbor: expected array of two integers in decimal fraction")
+	}
+
+	exp, err := r.integer()
+	if err != nil {
+		return nil, err
+	}
+	if !exp.IsInt64() {
+		return nil, errors.New("mendozacbor: exponent of decimal fraction is too large")
+	}
+
+	mantissa, err := r.integer()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Number(mantissa.String() + "e" + exp.String()), nil
+}
+
+func (r *reader) value(depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, errors.New("mendozacbor: value nested too deeply")
+	}
+
+	major, info, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		if arg <= math.MaxInt64 {
+			return int64(arg), nil
+		}
+		return arg, nil
+	case majorNegInt:
+		if arg <= math.MaxInt64 {
+			return -1 - int64(arg), nil
+		}
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Neg(n).Sub(n, big.NewInt(1)).String()), nil
+	case majorText:
+		return r.text(arg)
+	case majorArray:
+		// Every element takes at least one byte.
+		if arg > uint64(len(r.data)-r.pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		result := make([]interface{}, arg)
+		for i := range result {
+			result[i], err = r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case majorMap:
+		// Every entry takes at least two bytes.
+		if arg > uint64(len(r.data)-r.pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		result := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			major, _, length, err := r.head()
+			if err != nil {
+				return nil, err
+			}
+			if major != majorText {
+				return nil, errors.New("mendozacbor: object keys must be text strings")
+			}
+			key, err := r.text(length)
+			if err != nil {
+				return nil, err
+			}
+			result[key], err = r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case majorTag:
+		switch arg {
+		case tagPositiveBignum, tagNegativeBignum:
+			n, err := r.bignum(arg)
+			if err != nil {
+				return nil, err
+			}
+			return json.Number(n.String()), nil
+		case tagDecimalFraction:
+			return r.decimalFraction()
+		default:
+			return nil, fmt.Errorf("mendozacbor: unsupported tag %d", arg)
+		}
+	case majorSimple:
+		switch info {
+		case simpleFalse:
+			return false, nil
+		case simpleTrue:
+			return true, nil
+		case simpleNull, simpleUndefined:
+			return nil, nil
+		case simpleFloat16:
+			return fromFloat16(uint16(arg)), nil
+		case simpleFloat32:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case simpleFloat64:
+			return math.Float64frombits(arg), nil
+		}
+	}
+
+	return nil, fmt.Errorf("mendozacbor: unsupported item (major type %d, argument %d)", major, arg)
+}
@@ -0,0 +1,165 @@
+package mendozacbor_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/sanity-io/mendoza/pkg/mendozacbor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodingSize(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpBlank{},
+		&mendoza.OpArrayAppendSlice{Left: 0, Right: 6},
+	}
+
+	b, err := mendozacbor.Marshal(patch)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x84, 0x02, 0x15, 0x00, 0x06}, b)
+}
+
+func TestRoundtrip(t *testing.T) {
+	// This patch isn't valid, we're only testing that it roundtrips properly
+	patch := mendoza.Patch{
+		&mendoza.OpBlank{},
+		&mendoza.OpPushFieldCopy{OpPushField: mendoza.OpPushField{Index: 10}},
+		&mendoza.OpPushElement{Index: 1000000},
+		&mendoza.OpValue{Value: "abc"},
+		&mendoza.OpArrayAppendSlice{Left: 0, Right: 6},
+		&mendoza.OpObjectSetFieldValue{
+			OpValue:            mendoza.OpValue{Value: map[string]interface{}{"a": []interface{}{nil, true, false, 1.5, 1e300}}},
+			OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "key"},
+		},
+	}
+
+	b, err := mendozacbor.Marshal(patch)
+	require.NoError(t, err)
+
+	decodedPatch, err := mendozacbor.Unmarshal(b)
+	require.NoError(t, err)
+	require.EqualValues(t, patch, decodedPatch)
+}
+
+func TestEmptyPatch(t *testing.T) {
+	b, err := mendozacbor.Marshal(mendoza.Patch{})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x80}, b)
+
+	patch, err := mendozacbor.Unmarshal(b)
+	require.NoError(t, err)
+	require.Empty(t, patch)
+}
+
+// Examples from Appendix A of RFC 8949.
+var valueExamples = []struct {
+	value   interface{}
+	encoded string
+	decoded interface{}
+}{
+	{int64(0), "00", nil},
+	{int64(23), "17", nil},
+	{int64(24), "1818", nil},
+	{int64(1000000), "1a000f4240", nil},
+	{uint64(18446744073709551615), "1bffffffffffffffff", nil},
+	{json.Number("18446744073709551616"), "c249010000000000000000", nil},
+	{json.Number("-18446744073709551616"), "3bffffffffffffffff", nil},
+	{json.Number("-18446744073709551617"), "c349010000000000000000", nil},
+	{int64(-1000), "3903e7", nil},
+	{0.0, "f90000", nil},
+	{math.Copysign(0, -1), "f98000", nil},
+	{1.0, "f93c00", nil},
+	{1.1, "fb3ff199999999999a", nil},
+	{1.5, "f93e00", nil},
+	{65504.0, "f97bff", nil},
+	{100000.0, "fa47c35000", nil},
+	{3.4028234663852886e+38, "fa7f7fffff", nil},
+	{1.0e+300, "fb7e37e43c8800759c", nil},
+	{5.960464477539063e-8, "f90001", nil},
+	{0.00006103515625, "f90400", nil},
+	{-4.0, "f9c400", nil},
+	{-4.1, "fbc010666666666666", nil},
+	{math.Inf(1), "f97c00", nil},
+	{math.Inf(-1), "f9fc00", nil},
+	{float32(1.5), "f93e00", 1.5},
+	{false, "f4", nil},
+	{true, "f5", nil},
+	{nil, "f6", nil},
+	{"", "60", nil},
+	{"a", "6161", nil},
+	{"ü", "62c3bc", nil},
+	{[]interface{}{}, "80", nil},
+	{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}}, "8201820203", nil},
+	{map[string]interface{}{}, "a0", nil},
+	{map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, "a26161016162820203", nil},
+	{map[string]interface{}{"aa": nil, "b": nil, "c": nil}, "a36162f66163f6626161f6", nil},
+	{1, "01", int64(1)},
+	{json.Number("1.5"), "f93e00", 1.5},
+	{json.Number("1.00000000000000001"), "c482301b016345785d8a0001", json.Number("100000000000000001e-17")},
+	{json.Number("-0.1000000000000000000001"), "c48235c3493635c9adc5dea00000", json.Number("-1000000000000000000001e-22")},
+}
+
+func TestValues(t *testing.T) {
+	for _, example := range valueExamples {
+		b, err := mendozacbor.Marshal(mendoza.Patch{&mendoza.OpValue{Value: example.value}})
+		require.NoError(t, err)
+		require.Equal(t, "8200"+example.encoded, hex.EncodeToString(b), "%v", example.value)
+
+		patch, err := mendozacbor.Unmarshal(b)
+		require.NoError(t, err)
+
+		expected := example.decoded
+		if expected == nil {
+			expected = example.value
+		}
+		require.Equal(t, expected, patch[0].(*mendoza.OpValue).Value)
+	}
+
+	b, err := mendozacbor.Marshal(mendoza.Patch{&mendoza.OpValue{Value: math.NaN()}})
+	require.NoError(t, err)
+	require.Equal(t, "8200f97e00", hex.EncodeToString(b))
+}
+
+func TestEmbedded(t *testing.T) {
+	patch := mendozacbor.CBORPatch{&mendoza.OpValue{Value: "abc"}}
+
+	b, err := patch.MarshalCBOR()
+	require.NoError(t, err)
+
+	var decoded mendozacbor.CBORPatch
+	require.NoError(t, decoded.UnmarshalCBOR(b))
+	require.Equal(t, patch, decoded)
+}
+
+func TestInvalid(t *testing.T) {
+	b, err := mendozacbor.Marshal(mendoza.Patch{
+		&mendoza.OpObjectSetFieldValue{
+			OpValue:            mendoza.OpValue{Value: map[string]interface{}{"abc": "def"}},
+			OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "key"},
+		},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < len(b); i++ {
+		_, err := mendozacbor.Unmarshal(b[:i])
+		require.Equal(t, io.ErrUnexpectedEOF, err, "truncated at %d", i)
+	}
+
+	for _, data := range []string{
+		"a0",         // not an array
+		"8100ff",     // trailing data
+		"811901f4",   // invalid opcode
+		"9f00ff",     // indefinite length
+		"820041ff",   // byte string
+		"8200a10101", // non-text key
+		"820062c328", // invalid UTF-8
+	} {
+		b, _ := hex.DecodeString(data)
+		_, err := mendozacbor.Unmarshal(b)
+		require.Error(t, err, data)
+	}
+}
@@ -0,0 +1,143 @@
+package mendozamsgpack
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/vmihailenco/msgpack/v4"
+	"github.com/vmihailenco/msgpack/v4/codes"
+)
+
+// envelope is the Msgpack representation of an envelope: A map with the keys "version" (int),
+// "baseFingerprint" and "targetFingerprint" (bin), "createdAt" (timestamp), "metadata" (map of strings)
+// and "patch" (bin). The patch is stored as an encoded patch (see Marshal) so that it's only decoded
+// after the version has been checked.
+type envelope struct {
+	Version           int               `msgpack:"version"`
+	BaseFingerprint   []byte            `msgpack:"baseFingerprint,omitempty"`
+	TargetFingerprint []byte            `msgpack:"targetFingerprint,omitempty"`
+	CreatedAt         *timestamp        `msgpack:"createdAt,omitempty"`
+	Metadata          map[string]string `msgpack:"metadata,omitempty"`
+	Patch             []byte            `msgpack:"patch"`
+}
+
+// timestamp is a time encoded using the Msgpack timestamp extension type (-1). Without it
+// the time would be encoded using time.Time's MarshalBinary, which isn't portable.
+type timestamp time.Time
+
+var _ msgpack.CustomEncoder = (*timestamp)(nil)
+var _ msgpack.CustomDecoder = (*timestamp)(nil)
+
+func (ts *timestamp) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeTime(time.Time(*ts))
+}
+
+func (ts *timestamp) DecodeMsgpack(dec *msgpack.Decoder) error {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if !codes.IsExt(code) {
+		return errors.New("mendozamsgpack: expected timestamp")
+	}
+	tm, err := dec.DecodeTime()
+	if err != nil {
+		return err
+	}
+	*ts = timestamp(tm.UTC())
+	return nil
+}
+
+// MarshalEnvelope encodes a Mendoza envelope using Msgpack.
+func MarshalEnvelope(env *mendoza.Envelope) ([]byte, error) {
+	if env.Version != mendoza.EnvelopeVersion {
+		return nil, &mendoza.VersionError{Version: env.Version}
+	}
+
+	patch, err := Marshal(env.Patch)
+	if err != nil {
+		return nil, err
+	}
+
+	result := envelope{
+		Version:  env.Version,
+		Metadata: env.Metadata,
+		Patch:    patch,
+	}
+	if env.BaseFingerprint != nil {
+		result.BaseFingerprint = env.BaseFingerprint[:]
+	}
+	if env.TargetFingerprint != nil {
+		result.TargetFingerprint = env.TargetFingerprint[:]
+	}
+	if !env.CreatedAt.IsZero() {
+		createdAt := timestamp(env.CreatedAt)
+		result.CreatedAt = &createdAt
+	}
+
+	return msgpack.Marshal(&result)
+}
+
+// UnmarshalEnvelope decodes a Mendoza envelope using Msgpack. It returns a *mendoza.VersionError
+// if the envelope has a version which isn't supported.
+func UnmarshalEnvelope(data []byte) (*mendoza.Envelope, error) {
+	return UnmarshalEnvelopeWithOptions(data, mendoza.DecodeOptions{})
+}
+
+// UnmarshalEnvelopeWithOptions is like UnmarshalEnvelope, but returns a *mendoza.LimitError if the
+// patch exceeds any of the limits.
+func UnmarshalEnvelopeWithOptions(data []byte, opts mendoza.DecodeOptions) (*mendoza.Envelope, error) {
+	var src envelope
+	err := msgpack.Unmarshal(data, &src)
+	if err != nil {
+		return nil, err
+	}
+
+	if src.Version != mendoza.EnvelopeVersion {
+		return nil, &mendoza.VersionError{Version: src.Version}
+	}
+
+	if src.Patch == nil {
+		return nil, errors.New("mendozamsgpack: envelope is missing patch")
+	}
+
+	result := &mendoza.Envelope{
+		Version:  src.Version,
+		Metadata: src.Metadata,
+	}
+
+	if src.BaseFingerprint != nil {
+		result.BaseFingerprint, err = parseFingerprint(src.BaseFingerprint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if src.TargetFingerprint != nil {
+		result.TargetFingerprint, err = parseFingerprint(src.TargetFingerprint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if src.CreatedAt != nil {
+		result.CreatedAt = time.Time(*src.CreatedAt)
+	}
+
+	result.Patch, err = UnmarshalWithOptions(src.Patch, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func parseFingerprint(b []byte) (*mendoza.Fingerprint, error) {
+	var fp mendoza.Fingerprint
+	if len(b) != len(fp) {
+		return nil, errors.New("mendozamsgpack: invalid fingerprint")
+	}
+	copy(fp[:], b)
+	return &fp, nil
+}
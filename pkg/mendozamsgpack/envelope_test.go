@@ -0,0 +1,98 @@
+package mendozamsgpack_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/sanity-io/mendoza/pkg/mendozamsgpack"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+func TestEnvelope(t *testing.T) {
+	left := map[string]interface{}{"name": "Bob", "age": 10.0}
+	right := map[string]interface{}{"name": "Bob", "age": 15.0}
+
+	env, err := mendoza.CreateEnvelope(left, right)
+	require.NoError(t, err)
+	env.Metadata = map[string]string{"author": "alice"}
+
+	b, err := mendozamsgpack.MarshalEnvelope(env)
+	require.NoError(t, err)
+
+	decoded, err := mendozamsgpack.UnmarshalEnvelope(b)
+	require.NoError(t, err)
+	require.Equal(t, env.Version, decoded.Version)
+	require.Equal(t, env.BaseFingerprint, decoded.BaseFingerprint)
+	require.Equal(t, env.TargetFingerprint, decoded.TargetFingerprint)
+	require.True(t, env.CreatedAt.Equal(decoded.CreatedAt))
+	require.Equal(t, env.Metadata, decoded.Metadata)
+	require.EqualValues(t, env.Patch, decoded.Patch)
+
+	result, err := mendoza.ApplyEnvelope(left, decoded)
+	require.NoError(t, err)
+	require.Equal(t, right, result)
+}
+
+func TestEnvelopeMinimal(t *testing.T) {
+	env := &mendoza.Envelope{Version: mendoza.EnvelopeVersion, Patch: mendoza.Patch{}}
+
+	b, err := mendozamsgpack.MarshalEnvelope(env)
+	require.NoError(t, err)
+
+	decoded, err := mendozamsgpack.UnmarshalEnvelope(b)
+	require.NoError(t, err)
+	require.Equal(t, env, decoded)
+	require.Equal(t, time.Time{}, decoded.CreatedAt)
+}
+
+func TestEnvelopeUnknownVersion(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{"version": 2, "patch": []byte{0xff}})
+	require.NoError(t, err)
+
+	_, err = mendozamsgpack.UnmarshalEnvelope(b)
+	var versionErr *mendoza.VersionError
+	require.True(t, errors.As(err, &versionErr), "expected VersionError, got %v", err)
+	require.Equal(t, 2, versionErr.Version)
+
+	_, err = mendozamsgpack.MarshalEnvelope(&mendoza.Envelope{Version: 2})
+	require.True(t, errors.As(err, &versionErr), "expected VersionError, got %v", err)
+}
+
+func TestEnvelopeCreatedAt(t *testing.T) {
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	env := &mendoza.Envelope{Version: mendoza.EnvelopeVersion, CreatedAt: createdAt, Patch: mendoza.Patch{}}
+
+	b, err := mendozamsgpack.MarshalEnvelope(env)
+	require.NoError(t, err)
+
+	// The time is encoded using the timestamp extension type so that other implementations can read it.
+	var raw map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(b, &raw))
+	require.IsType(t, &time.Time{}, raw["createdAt"])
+	require.True(t, createdAt.Equal(*raw["createdAt"].(*time.Time)))
+
+	decoded, err := mendozamsgpack.UnmarshalEnvelope(b)
+	require.NoError(t, err)
+	require.Equal(t, createdAt, decoded.CreatedAt)
+}
+
+func TestEnvelopeWithOptions(t *testing.T) {
+	left := map[string]interface{}{"name": "Bob"}
+	right := map[string]interface{}{"name": "Alice"}
+
+	env, err := mendoza.CreateEnvelope(left, right)
+	require.NoError(t, err)
+
+	b, err := mendozamsgpack.MarshalEnvelope(env)
+	require.NoError(t, err)
+
+	_, err = mendozamsgpack.UnmarshalEnvelopeWithOptions(b, mendoza.DecodeOptions{MaxStringBytes: 100})
+	require.NoError(t, err)
+
+	_, err = mendozamsgpack.UnmarshalEnvelopeWithOptions(b, mendoza.DecodeOptions{MaxStringBytes: 3})
+	var limitErr *mendoza.LimitError
+	require.True(t, errors.As(err, &limitErr), "expected LimitError, got %v", err)
+}
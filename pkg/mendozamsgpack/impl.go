@@ -1,9 +1,16 @@
 package mendozamsgpack
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/sanity-io/mendoza"
+	internal "github.com/sanity-io/mendoza/internal/mendoza"
 	"github.com/vmihailenco/msgpack/v4"
+	"github.com/vmihailenco/msgpack/v4/codes"
 	"io"
+	"strconv"
+	"strings"
 )
 
 // MsgpackPatch is an alias for mendoza.Patch which implements CustomEncoder/CustomDecoder.
@@ -37,6 +44,13 @@ func Unmarshal(data []byte) (mendoza.Patch, error) {
 	return mendoza.Patch(mppatch), nil
 }
 
+// UnmarshalWithOptions decodes a Mendoza patch using Msgpack,
+// returning a *mendoza.LimitError if the patch exceeds any of the limits.
+func UnmarshalWithOptions(data []byte, opts mendoza.DecodeOptions) (mendoza.Patch, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	return opts.ReadPatch(reader{dec})
+}
+
 
 type writer struct {
 	*msgpack.Encoder
@@ -55,9 +69,105 @@ func (w writer) WriteString(v string) error {
 }
 
 func (w writer) WriteValue(v interface{}) error {
+	v, _, err := nativeNumbers(v)
+	if err != nil {
+		return err
+	}
 	return w.Encode(v)
 }
 
+// numberExtID is the Msgpack extension type used for numbers which can't be represented as an
+// int64/uint64/float64 without losing precision. The data is the number in the JSON syntax (encoded as a
+// Msgpack string), and it's decoded as a json.Number.
+const numberExtID int8 = 77
+
+// number is a json.Number which is encoded using numberExtID.
+type number string
+
+func init() {
+	msgpack.RegisterExt(numberExtID, (*number)(nil))
+}
+
+func (n number) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeString(string(n))
+}
+
+func (n *number) DecodeMsgpack(dec *msgpack.Decoder) error {
+	s, err := dec.DecodeString()
+	if err != nil {
+		return err
+	}
+	if _, _, ok := internal.NumberDecimal(s); !ok {
+		return fmt.Errorf("invalid number in msgpack: %q", s)
+	}
+	*n = number(s)
+	return nil
+}
+
+// nativeNumbers converts json.Number into int64/uint64/float64 since msgpack would otherwise encode it
+// as a string. Numbers which can't be converted without losing precision are encoded using numberExtID.
+// Maps and slices are only copied if they contain a json.Number.
+func nativeNumbers(v interface{}) (interface{}, bool, error) {
+	switch v := v.(type) {
+	case json.Number:
+		s := string(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, true, nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return u, true, nil
+		}
+		if strings.ContainsAny(s, ".eE") {
+			if f, ok := internal.NumberFloat64(s); ok {
+				return f, true, nil
+			}
+		}
+		if _, _, ok := internal.NumberDecimal(s); ok {
+			return number(s), true, nil
+		}
+		return nil, false, fmt.Errorf("invalid number: %s", s)
+	case map[string]interface{}:
+		var result map[string]interface{}
+		for key, item := range v {
+			converted, changed, err := nativeNumbers(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed && result == nil {
+				result = make(map[string]interface{}, len(v))
+				for k, i := range v {
+					result[k] = i
+				}
+			}
+			if result != nil {
+				result[key] = converted
+			}
+		}
+		if result != nil {
+			return result, true, nil
+		}
+	case []interface{}:
+		var result []interface{}
+		for idx, item := range v {
+			converted, changed, err := nativeNumbers(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed && result == nil {
+				result = make([]interface{}, len(v))
+				copy(result, v)
+			}
+			if result != nil {
+				result[idx] = converted
+			}
+		}
+		if result != nil {
+			return result, true, nil
+		}
+	}
+	return v, false, nil
+}
+
 func (patch *MsgpackPatch) EncodeMsgpack(enc *msgpack.Encoder) error {
 	w := writer{enc}
 	for _, op := range *patch {
@@ -70,6 +180,8 @@ func (patch *MsgpackPatch) EncodeMsgpack(enc *msgpack.Encoder) error {
 	return nil
 }
 
+const maxInt = ^uint(0) >> 1
+
 type reader struct {
 	*msgpack.Decoder
 }
@@ -80,7 +192,13 @@ func (r reader) ReadUint8() (uint8, error) {
 
 func (r reader) ReadUint() (int, error) {
 	val, err := r.DecodeUint()
-	return int(val), err
+	if err != nil {
+		return 0, err
+	}
+	if val > maxInt {
+		return 0, fmt.Errorf("number too large: %d", val)
+	}
+	return int(val), nil
 }
 
 func (r reader) ReadString() (string, error) {
@@ -88,12 +206,145 @@ func (r reader) ReadString() (string, error) {
 }
 
 func (r reader) ReadValue() (interface{}, error) {
-	var result interface{}
-	err := r.Decode(&result)
+	return r.readLimitedValue(&mendoza.ValueLimits{}, 0)
+}
+
+// maxPrealloc is the largest number of items allocated up front for an array/map. Larger
+// arrays/maps grow as their items are read so that a large length can't allocate a lot of memory.
+const maxPrealloc = 1024
+
+// chunkSize is the largest number of bytes allocated up front for a string.
+const chunkSize = 64 * 1024
+
+var _ mendoza.LimitedReader = reader{}
+
+func (r reader) ReadLimitedString(limits *mendoza.ValueLimits) (string, error) {
+	c, err := r.PeekCode()
+	if err != nil {
+		return "", err
+	}
+	if !codes.IsString(c) && !codes.IsBin(c) {
+		// Let the decoder report the error.
+		return r.DecodeString()
+	}
+	b, err := r.readBytes(limits)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r reader) ReadLimitedValue(limits *mendoza.ValueLimits) (interface{}, error) {
+	return r.readLimitedValue(limits, 0)
+}
+
+// readLimitedValue decodes a value the same way as Decode, except that the length of every
+// string and the nesting of arrays/maps is checked before they're read, and that numbers
+// encoded using numberExtID are decoded as json.Number.
+func (r reader) readLimitedValue(limits *mendoza.ValueLimits, depth int) (interface{}, error) {
+	c, err := r.PeekCode()
 	if err != nil {
 		return nil, err
 	}
-	return result, nil
+
+	switch {
+	case codes.IsString(c):
+		b, err := r.readBytes(limits)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case codes.IsBin(c):
+		return r.readBytes(limits)
+	case codes.IsFixedArray(c) || c == codes.Array16 || c == codes.Array32:
+		err = limits.Nested(depth)
+		if err != nil {
+			return nil, err
+		}
+		n, err := r.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, 0, minInt(n, maxPrealloc))
+		for i := 0; i < n; i++ {
+			item, err := r.readLimitedValue(limits, depth+1)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	case codes.IsFixedMap(c) || c == codes.Map16 || c == codes.Map32:
+		err = limits.Nested(depth)
+		if err != nil {
+			return nil, err
+		}
+		n, err := r.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{}, minInt(n, maxPrealloc))
+		for i := 0; i < n; i++ {
+			key, err := r.ReadLimitedString(limits)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			item, err := r.readLimitedValue(limits, depth+1)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			result[key] = item
+		}
+		return result, nil
+	}
+
+	value, err := r.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := value.(*number); ok {
+		return json.Number(*n), nil
+	}
+	return value, nil
+}
+
+// readBytes reads a string or binary value. The length is checked before the data is read, and the buffer grows
+// while reading so that a large length can't allocate more memory than the size of the input.
+func (r reader) readBytes(limits *mendoza.ValueLimits) ([]byte, error) {
+	n, err := r.DecodeBytesLen()
+	if err != nil {
+		return nil, err
+	}
+	err = limits.String(n)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, minInt(n, chunkSize))
+	for len(b) < n {
+		start := len(b)
+		b = append(b, make([]byte, minInt(n-start, chunkSize))...)
+		_, err = io.ReadFull(r.Buffered(), b[start:])
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return b, nil
+}
+
+// unexpectedEOF makes sure that running out of data in the middle of a value isn't treated as the end of the patch.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 func (patch *MsgpackPatch) DecodeMsgpack(dec *msgpack.Decoder) error {
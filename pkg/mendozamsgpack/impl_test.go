@@ -1,6 +1,9 @@
 package mendozamsgpack_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"github.com/sanity-io/mendoza"
 	"github.com/sanity-io/mendoza/pkg/mendozamsgpack"
 	"github.com/stretchr/testify/require"
@@ -65,3 +68,104 @@ func TestEmptyPatch(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, b)
 }
+
+func TestNumbers(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpValue{Value: map[string]interface{}{
+			"a": json.Number("9007199254740993"),
+			"b": []interface{}{json.Number("18446744073709551615"), json.Number("1.5")},
+			"c": int64(-5),
+		}},
+	}
+
+	b, err := mendozamsgpack.Marshal(patch)
+	require.NoError(t, err)
+
+	decodedPatch, err := mendozamsgpack.Unmarshal(b)
+	require.NoError(t, err)
+
+	require.EqualValues(t, mendoza.Patch{
+		&mendoza.OpValue{Value: map[string]interface{}{
+			"a": int64(9007199254740993),
+			"b": []interface{}{uint64(18446744073709551615), 1.5},
+			"c": int64(-5),
+		}},
+	}, decodedPatch)
+
+	// Numbers which don't fit in an int64/uint64/float64 roundtrip as json.Number.
+	for _, value := range []interface{}{
+		json.Number("123456789012345678901234567890"),
+		json.Number("0.1000000000000000000001"),
+		[]interface{}{json.Number("-123456789012345678901234567890")},
+		map[string]interface{}{"id": json.Number("1e400")},
+	} {
+		patch := mendoza.Patch{&mendoza.OpValue{Value: value}}
+		b, err := mendozamsgpack.Marshal(patch)
+		require.NoError(t, err)
+
+		decodedPatch, err := mendozamsgpack.Unmarshal(b)
+		require.NoError(t, err)
+		require.EqualValues(t, patch, decodedPatch)
+
+		decodedPatch, err = mendozamsgpack.UnmarshalWithOptions(b, mendoza.DecodeOptions{MaxDepth: 2})
+		require.NoError(t, err)
+		require.EqualValues(t, patch, decodedPatch)
+	}
+
+	_, err = mendozamsgpack.Marshal(mendoza.Patch{&mendoza.OpValue{Value: json.Number("abc")}})
+	require.Error(t, err)
+}
+
+func TestUnmarshalWithOptions(t *testing.T) {
+	patch := mendoza.Patch{
+		&mendoza.OpValue{Value: []interface{}{"abc", []interface{}{"def"}}},
+		&mendoza.OpPushElement{Index: 5},
+	}
+
+	b, err := mendozamsgpack.Marshal(patch)
+	require.NoError(t, err)
+
+	decodedPatch, err := mendozamsgpack.UnmarshalWithOptions(b, mendoza.DecodeOptions{MaxOps: 2, MaxStringBytes: 6, MaxDepth: 2, MaxIndex: 5})
+	require.NoError(t, err)
+	require.EqualValues(t, patch, decodedPatch)
+
+	for _, opts := range []mendoza.DecodeOptions{
+		{MaxOps: 1},
+		{MaxStringBytes: 5},
+		{MaxDepth: 1},
+		{MaxIndex: 4},
+	} {
+		_, err = mendozamsgpack.UnmarshalWithOptions(b, opts)
+		var limitErr *mendoza.LimitError
+		require.True(t, errors.As(err, &limitErr), "expected LimitError, got %v", err)
+	}
+}
+
+func TestUnmarshalWithOptionsDeepValue(t *testing.T) {
+	// An OpValue containing five million nested arrays.
+	b := append([]byte{0}, bytes.Repeat([]byte{0x91}, 5000000)...)
+	b = append(b, 0xc0)
+
+	_, err := mendozamsgpack.UnmarshalWithOptions(b, mendoza.DecodeOptions{MaxDepth: 10})
+	var limitErr *mendoza.LimitError
+	require.True(t, errors.As(err, &limitErr), "expected LimitError, got %v", err)
+	require.Equal(t, "MaxDepth", limitErr.Limit)
+
+	// Values are never nested deeper than 10000 levels, even without MaxDepth.
+	_, err = mendozamsgpack.UnmarshalWithOptions(b, mendoza.DecodeOptions{MaxStringBytes: 10})
+	require.Error(t, err)
+}
+
+func TestUnmarshalWithOptionsLongString(t *testing.T) {
+	// An OpValue with a str32 claiming to be 4 GB long, followed by only a few bytes.
+	b := []byte{0, 0xdb, 0xff, 0xff, 0xff, 0xff, 'a', 'b', 'c'}
+
+	_, err := mendozamsgpack.UnmarshalWithOptions(b, mendoza.DecodeOptions{MaxStringBytes: 100})
+	var limitErr *mendoza.LimitError
+	require.True(t, errors.As(err, &limitErr), "expected LimitError, got %v", err)
+	require.Equal(t, "MaxStringBytes", limitErr.Limit)
+
+	// Without a limit the length is only trusted as far as there's data.
+	_, err = mendozamsgpack.UnmarshalWithOptions(b, mendoza.DecodeOptions{MaxDepth: 10})
+	require.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package mendoza
+
+import (
+	"context"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// PreparedDocument is a left document which has been hashed and indexed up front. This is useful
+// when the same document is diffed against many right documents (see CreatePatchFrom).
+//
+// A PreparedDocument is immutable and safe for concurrent use by multiple goroutines.
+// The underlying document must not be modified while it's in use.
+type PreparedDocument struct {
+	hashList  *mendoza.HashList
+	hashIndex *mendoza.HashIndex
+	options   Options
+}
+
+// Prepare hashes and indexes a document so that it can be used as the left document in CreatePatchFrom.
+//
+// This function uses the default options.
+func Prepare(doc interface{}) (*PreparedDocument, error) {
+	return DefaultOptions.Prepare(doc)
+}
+
+// Prepare hashes and indexes a document so that it can be used as the left document in CreatePatchFrom.
+// The options are stored in the prepared document and used by CreatePatchFrom.
+func (options *Options) Prepare(doc interface{}) (*PreparedDocument, error) {
+	prepared := &PreparedDocument{options: *options}
+
+	if doc == nil {
+		return prepared, nil
+	}
+
+	hashList, err := mendoza.HashListFor(doc, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared.hashList = hashList
+	prepared.hashIndex = mendoza.NewHashIndex(hashList)
+	return prepared, nil
+}
+
+// CreatePatchFrom creates a patch which can be applied to the prepared document to produce the right document.
+// This produces the same patch as CreatePatch, but avoids hashing and indexing the left document again.
+func CreatePatchFrom(prepared *PreparedDocument, right interface{}) (Patch, error) {
+	return CreatePatchFromContext(context.Background(), prepared, right)
+}
+
+// CreatePatchFromContext is like CreatePatchFrom, but it can be cancelled (see CreatePatchContext).
+func CreatePatchFromContext(ctx context.Context, prepared *PreparedDocument, right interface{}) (Patch, error) {
+	options := prepared.options
+
+	if prepared.hashList == nil {
+		return options.createPatch(ctx, nil, right, &Stats{})
+	}
+
+	return options.createPatchFrom(ctx, prepared.hashList, prepared.hashIndex, right, &Stats{})
+}
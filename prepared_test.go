@@ -0,0 +1,54 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePatchFrom(t *testing.T) {
+	var left interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "a", "b": [1, 2, {"c": "c"}], "d": {"e": "e"}}`), &left))
+
+	prepared, err := mendoza.Prepare(left)
+	require.NoError(t, err)
+
+	targets := []string{
+		`{"a": "b", "b": [1, 2, {"c": "c"}], "d": {"e": "e"}}`,
+		`{"a": "a", "b": [2, {"c": "d"}], "d": {"e": "e"}}`,
+		`{"f": {"e": "e"}}`,
+		`[1, 2]`,
+		`null`,
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		var right interface{}
+		require.NoError(t, json.Unmarshal([]byte(target), &right))
+
+		expected, err := mendoza.CreatePatch(left, right)
+		require.NoError(t, err)
+		require.EqualValues(t, right, mendoza.ApplyPatch(left, expected))
+
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				patch, err := mendoza.CreatePatchFrom(prepared, right)
+				assert.NoError(t, err)
+				assert.EqualValues(t, expected, patch)
+			}()
+		}
+	}
+	wg.Wait()
+
+	prepared, err = mendoza.Prepare(nil)
+	require.NoError(t, err)
+	patch, err := mendoza.CreatePatchFrom(prepared, "abc")
+	require.NoError(t, err)
+	require.EqualValues(t, mendoza.Patch{&mendoza.OpValue{Value: "abc"}}, patch)
+}
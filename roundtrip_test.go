@@ -128,6 +128,8 @@ func TestRoundtrip(t *testing.T) {
 
 			patch1, patch2, err := mendoza.CreateDoublePatch(left, right)
 			require.NoError(t, err)
+			require.NoError(t, mendoza.Validate(patch1))
+			require.NoError(t, mendoza.Validate(patch2))
 
 			result1 := mendoza.ApplyPatch(left, patch1)
 			require.EqualValues(t, right, result1)
@@ -157,3 +159,41 @@ func TestRoundtrip(t *testing.T) {
 		})
 	}
 }
+
+func TestRoundtripOptions(t *testing.T) {
+	variants := map[string]mendoza.Options{
+		"MaxCandidates": mendoza.DefaultOptions.WithMaxCandidates(1),
+		"NoFuzzy":       mendoza.DefaultOptions.WithFuzzyMatching(false),
+		"MaxDepth":      mendoza.DefaultOptions.WithMaxDepth(1),
+		"StringLine":    mendoza.DefaultOptions.WithStringDiff(mendoza.StringDiffLine),
+		"StringWord":    mendoza.DefaultOptions.WithStringDiff(mendoza.StringDiffWord),
+		"StringChar":    mendoza.DefaultOptions.WithStringDiff(mendoza.StringDiffChar),
+	}
+
+	for name, opts := range variants {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			for _, pair := range Documents {
+				var left, right interface{}
+				require.NoError(t, json.Unmarshal([]byte(pair.Left), &left))
+				require.NoError(t, json.Unmarshal([]byte(pair.Right), &right))
+
+				patch, err := opts.CreatePatch(left, right)
+				require.NoError(t, err)
+				require.EqualValues(t, right, opts.ApplyPatch(left, patch))
+			}
+		})
+	}
+
+	var left, right interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": {"b": {"c": "abcdefghijklmnop"}}}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"a": {"b": {"c": "abcdefghijklmnopq"}}}`), &right))
+
+	opts := mendoza.DefaultOptions.WithMaxDepth(2)
+	patch, err := opts.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, right, opts.ApplyPatch(left, patch))
+	for _, op := range patch {
+		require.NotEqual(t, &mendoza.OpStringAppendSlice{Left: 0, Right: 16}, op)
+	}
+}
@@ -0,0 +1,52 @@
+package mendoza
+
+import (
+	"context"
+	"time"
+)
+
+// Stats contains information about how the differ created a patch.
+// This is useful for understanding why a patch is larger (or slower to create) than expected.
+type Stats struct {
+	// LeftEntries is the number of values (including nested values) in the left document.
+	LeftEntries int
+	// RightEntries is the number of values (including nested values) in the right document.
+	RightEntries int
+
+	// MapCandidates is the number of candidate objects considered while reconstructing objects.
+	MapCandidates int
+	// SliceCandidates is the number of candidate arrays considered while reconstructing arrays.
+	SliceCandidates int
+
+	// ExactAliases is the number of fields/elements found unchanged in a candidate using the hash index.
+	ExactAliases int
+	// FuzzyMatches is the number of candidate objects found using the xor-index (i.e. objects which differ in one field).
+	FuzzyMatches int
+
+	// EstimatedSize is the size of the patch as estimated by the differ's cost model.
+	EstimatedSize int
+
+	// HashingTime is the time spent hashing the left and right documents.
+	HashingTime time.Duration
+	// IndexingTime is the time spent building the hash index of the left document.
+	IndexingTime time.Duration
+	// ReconstructionTime is the time spent finding the differences and building the patch.
+	ReconstructionTime time.Duration
+}
+
+// CreatePatchWithStats creates a patch (see CreatePatch) and returns statistics about how it was created.
+//
+// This function uses the default options.
+func CreatePatchWithStats(left, right interface{}) (Patch, *Stats, error) {
+	return DefaultOptions.CreatePatchWithStats(left, right)
+}
+
+// CreatePatchWithStats creates a patch (see CreatePatch) and returns statistics about how it was created.
+func (options *Options) CreatePatchWithStats(left, right interface{}) (Patch, *Stats, error) {
+	stats := &Stats{}
+	patch, err := options.createPatch(context.Background(), left, right, stats)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patch, stats, nil
+}
@@ -0,0 +1,30 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePatchWithStats(t *testing.T) {
+	var left, right interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "Bob", "age": 30, "skills": ["Go", "Patching", "Playing"]}`), &left))
+	require.NoError(t, json.Unmarshal([]byte(`{"firstName": "Bob", "age": 30, "skills": ["Diffing", "Go", "Patching"]}`), &right))
+
+	patch, stats, err := mendoza.CreatePatchWithStats(left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+
+	expected, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.EqualValues(t, expected, patch)
+
+	require.Equal(t, 7, stats.LeftEntries)
+	require.Equal(t, 7, stats.RightEntries)
+	require.Equal(t, 1, stats.MapCandidates)
+	require.Equal(t, 1, stats.SliceCandidates)
+	require.True(t, stats.ExactAliases > 0)
+	require.True(t, stats.EstimatedSize > 0)
+}
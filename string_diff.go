@@ -0,0 +1,271 @@
+package mendoza
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// StringDiff controls how the differ finds the differences between two strings.
+type StringDiff int
+
+const (
+	// StringDiffAffix only looks for a common prefix and suffix and replaces everything in between.
+	// This is the default and is the fastest.
+	StringDiffAffix StringDiff = iota
+	// StringDiffLine finds the common lines of the two strings.
+	StringDiffLine
+	// StringDiffWord finds the common words (and whitespace) of the two strings.
+	StringDiffWord
+	// StringDiffChar finds the common characters of the two strings.
+	StringDiffChar
+)
+
+// maxStringDiffEdits is the maximum number of inserted/deleted tokens the string diff will look for
+// before giving up and falling back to only using the common prefix/suffix.
+const maxStringDiffEdits = 1000
+
+// token is a byte range in a string.
+type token struct {
+	start int
+	end   int
+}
+
+func tokenize(s string, mode StringDiff) []token {
+	tokens := []token{}
+	i := 0
+
+	for i < len(s) {
+		start := i
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		switch mode {
+		case StringDiffLine:
+			for r != '\n' && i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				i += size
+			}
+		case StringDiffWord:
+			class := runeClass(r)
+			if class != 0 {
+				for i < len(s) {
+					r, size = utf8.DecodeRuneInString(s[i:])
+					if runeClass(r) != class {
+						break
+					}
+					i += size
+				}
+			}
+		}
+
+		tokens = append(tokens, token{start, i})
+	}
+
+	return tokens
+}
+
+// runeClass groups runes into words (1), whitespace (2) and punctuation/symbols (0).
+// Punctuation is never grouped together.
+func runeClass(r rune) int {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+		return 1
+	}
+	if unicode.IsSpace(r) {
+		return 2
+	}
+	return 0
+}
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editInsert
+	editDelete
+)
+
+type edit struct {
+	kind  editKind
+	left  int
+	right int
+}
+
+// myers finds the shortest edit script which turns a sequence of length n into a sequence of length m,
+// using the algorithm described in "An O(ND) Difference Algorithm and Its Variations" (Myers, 1986).
+// eq(i, j) compares element i of the first sequence with element j of the second.
+//
+// It gives up (and returns false) if the edit script requires more than maxEdits insertions/deletions,
+// or if cancelled (which may be nil) returns true.
+func myers(n, m int, eq func(i, j int) bool, maxEdits int, cancelled func() bool) ([]edit, bool) {
+	if maxEdits > n+m {
+		maxEdits = n + m
+	}
+
+	offset := maxEdits + 1
+	v := make([]int, 2*maxEdits+3)
+
+	// trace[d] contains v[-d-1..d+1] before round d.
+	trace := [][]int{}
+
+	for d := 0; d <= maxEdits; d++ {
+		if cancelled != nil && cancelled() {
+			return nil, false
+		}
+
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && eq(x, y) {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func backtrack(trace [][]int, n, m int) []edit {
+	edits := []edit{}
+	x, y := n, m
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		// v is stored with an offset of d+1
+		var prevK int
+		if k == -d || (k != d && v[d+1+k-1] < v[d+1+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{editEqual, x, y})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{editInsert, x, prevY})
+			} else {
+				edits = append(edits, edit{editDelete, prevX, y})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
+
+// stringSegment is a part of the right string, given by a byte range in the right string.
+// If isSlice is set it can also be produced by slicing the left string from start to end.
+type stringSegment struct {
+	isSlice    bool
+	start      int
+	end        int
+	rightStart int
+	rightEnd   int
+}
+
+func appendSegment(segments []stringSegment, seg stringSegment) []stringSegment {
+	if seg.rightStart == seg.rightEnd {
+		return segments
+	}
+
+	if len(segments) > 0 {
+		last := &segments[len(segments)-1]
+		if last.isSlice == seg.isSlice && (!seg.isSlice || last.end == seg.start) {
+			last.end = seg.end
+			last.rightEnd = seg.rightEnd
+			return segments
+		}
+	}
+
+	return append(segments, seg)
+}
+
+// affixSegments describes the right string as the common prefix/suffix of the left string
+// with everything in between replaced.
+func affixSegments(leftString, rightString string) []stringSegment {
+	segments := []stringSegment{}
+
+	prefix := commonPrefix(leftString, rightString)
+	suffix := commonSuffix(leftString, rightString, prefix)
+
+	rightSuffix := len(rightString) - suffix
+	leftSuffix := len(leftString) - suffix
+
+	segments = appendSegment(segments, stringSegment{isSlice: true, start: 0, end: prefix, rightStart: 0, rightEnd: prefix})
+	segments = appendSegment(segments, stringSegment{rightStart: prefix, rightEnd: rightSuffix})
+	segments = appendSegment(segments, stringSegment{isSlice: true, start: leftSuffix, end: len(leftString), rightStart: rightSuffix, rightEnd: len(rightString)})
+
+	return segments
+}
+
+// tokenSegments describes the right string using a token-level diff against the left string.
+// It returns false if the strings are too different for the diff to be useful, or if the diff was cancelled.
+func tokenSegments(leftString, rightString string, mode StringDiff, cancelled func() bool) ([]stringSegment, bool) {
+	leftTokens := tokenize(leftString, mode)
+	rightTokens := tokenize(rightString, mode)
+
+	eq := func(i, j int) bool {
+		lt, rt := leftTokens[i], rightTokens[j]
+		return leftString[lt.start:lt.end] == rightString[rt.start:rt.end]
+	}
+
+	edits, ok := myers(len(leftTokens), len(rightTokens), eq, maxStringDiffEdits, cancelled)
+	if !ok {
+		return nil, false
+	}
+
+	segments := []stringSegment{}
+
+	for _, e := range edits {
+		switch e.kind {
+		case editEqual:
+			lt, rt := leftTokens[e.left], rightTokens[e.right]
+			segments = appendSegment(segments, stringSegment{isSlice: true, start: lt.start, end: lt.end, rightStart: rt.start, rightEnd: rt.end})
+		case editInsert:
+			rt := rightTokens[e.right]
+			segments = appendSegment(segments, stringSegment{rightStart: rt.start, rightEnd: rt.end})
+		}
+	}
+
+	// Slices which are shorter than the operation itself are cheaper to include as-is.
+	result := []stringSegment{}
+	for _, seg := range segments {
+		if seg.isSlice && seg.end-seg.start < 3 {
+			seg.isSlice = false
+		}
+		result = appendSegment(result, seg)
+	}
+
+	return result, true
+}
@@ -0,0 +1,59 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func patchSize(t *testing.T, patch mendoza.Patch) int {
+	b, err := json.Marshal(patch)
+	require.NoError(t, err)
+	return len(b)
+}
+
+func TestStringDiff(t *testing.T) {
+	paragraph := strings.Repeat("Mendoza looks at two structured documents and constructs a patch. ", 10)
+
+	pairs := []struct {
+		Left  string
+		Right string
+	}{
+		{paragraph, strings.Replace(strings.Replace(paragraph, "looks", "peeks", 1), "patch.", "diff.", -1)},
+		{"line one\nline two\nline three\n", "line zero\nline one\nline three\nline four\n"},
+		{"blåbærsyltetøy på skiva", "blåbærsyltetøy på brødskiva"},
+		{"݆݆݅Ʌ", "І݆Ʌ"},
+		{"abc", ""},
+		{"", "abc"},
+	}
+
+	modes := []mendoza.StringDiff{mendoza.StringDiffLine, mendoza.StringDiffWord, mendoza.StringDiffChar}
+
+	for _, pair := range pairs {
+		left := map[string]interface{}{"text": pair.Left}
+		right := map[string]interface{}{"text": pair.Right}
+
+		_, affixStats, err := mendoza.CreatePatchWithStats(left, right)
+		require.NoError(t, err)
+
+		for _, mode := range modes {
+			opts := mendoza.DefaultOptions.WithStringDiff(mode)
+			patch, stats, err := opts.CreatePatchWithStats(left, right)
+			require.NoError(t, err)
+			require.EqualValues(t, right, mendoza.ApplyPatch(left, patch))
+			require.True(t, stats.EstimatedSize <= affixStats.EstimatedSize)
+		}
+	}
+
+	left := map[string]interface{}{"text": pairs[0].Left}
+	right := map[string]interface{}{"text": pairs[0].Right}
+	affixPatch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+	opts := mendoza.DefaultOptions.WithStringDiff(mendoza.StringDiffWord)
+	wordPatch, err := opts.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.True(t, patchSize(t, wordPatch)*2 < patchSize(t, affixPatch))
+}
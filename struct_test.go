@@ -0,0 +1,147 @@
+package mendoza_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/sanity-io/mendoza/pkg/mendozamsgpack"
+	"github.com/stretchr/testify/require"
+)
+
+type Address struct {
+	Street string `json:"street"`
+	Zip    int    `json:"zip,omitempty"`
+}
+
+type Timestamps struct {
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Person struct {
+	Timestamps
+	Name     string            `json:"name"`
+	Age      int               `json:"age"`
+	Email    *string           `json:"email,omitempty"`
+	Address  *Address          `json:"address"`
+	Previous []Address         `json:"previous"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Scores   map[int]float64   `json:"scores,omitempty"`
+	Secret   string            `json:"-"`
+	internal string
+}
+
+func TestStructs(t *testing.T) {
+	email := "michael@bluth.com"
+	created := time.Date(2003, 11, 2, 0, 0, 0, 0, time.UTC)
+
+	left := Person{
+		Timestamps: Timestamps{CreatedAt: created},
+		Name:       "Michael Bluth",
+		Age:        35,
+		Address:    &Address{Street: "1 Model Home", Zip: 92660},
+		Previous:   []Address{{Street: "Balboa Towers"}},
+		Tags:       map[string]string{"role": "president"},
+		Secret:     "banana stand",
+		internal:   "money",
+	}
+
+	right := left
+	right.Age = 36
+	right.Email = &email
+	right.Address = &Address{Street: "1 Model Home", Zip: 92661}
+	right.Previous = []Address{{Street: "Balboa Towers"}, {Street: "Sudden Valley", Zip: 92630}}
+	right.Scores = map[int]float64{1: 0.5}
+
+	patch, err := mendoza.CreatePatch(left, right)
+	require.NoError(t, err)
+
+	t.Run("ApplyPatchInto", func(t *testing.T) {
+		var result Person
+		err := mendoza.ApplyPatchInto(&result, left, patch)
+		require.NoError(t, err)
+
+		expected := right
+		expected.Secret = ""
+		expected.internal = ""
+		require.Equal(t, expected, result)
+	})
+
+	t.Run("Equivalent", func(t *testing.T) {
+		patch, err := mendoza.CreatePatch(left, left)
+		require.NoError(t, err)
+		require.Empty(t, patch)
+	})
+
+	t.Run("MatchesJSON", func(t *testing.T) {
+		var jsonLeft interface{}
+		data, err := json.Marshal(left)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &jsonLeft))
+
+		fingerprint, err := mendoza.FingerprintOf(left)
+		require.NoError(t, err)
+		jsonFingerprint, err := mendoza.FingerprintOf(jsonLeft)
+		require.NoError(t, err)
+		require.Equal(t, jsonFingerprint, fingerprint)
+	})
+
+	t.Run("Serializable", func(t *testing.T) {
+		data, err := json.Marshal(patch)
+		require.NoError(t, err)
+
+		var jsonPatch mendoza.Patch
+		require.NoError(t, json.Unmarshal(data, &jsonPatch))
+
+		var result Person
+		require.NoError(t, mendoza.ApplyPatchInto(&result, left, jsonPatch))
+		require.Equal(t, right.Address, result.Address)
+
+		data, err = mendozamsgpack.Marshal(patch)
+		require.NoError(t, err)
+
+		msgpackPatch, err := mendozamsgpack.Unmarshal(data)
+		require.NoError(t, err)
+
+		result = Person{}
+		require.NoError(t, mendoza.ApplyPatchInto(&result, left, msgpackPatch))
+		require.Equal(t, right.Previous, result.Previous)
+	})
+
+	t.Run("FromNil", func(t *testing.T) {
+		patch, err := mendoza.CreatePatch(nil, right)
+		require.NoError(t, err)
+		require.IsType(t, map[string]interface{}{}, patch[0].(*mendoza.OpValue).Value)
+	})
+}
+
+func TestUnsupportedType(t *testing.T) {
+	_, err := mendoza.CreatePatch(map[string]interface{}{}, map[string]interface{}{"a": make(chan int)})
+	require.Error(t, err)
+}
+
+func TestConvertOnce(t *testing.T) {
+	// The convert function is only invoked once for every value in the right document,
+	// so it's fine if it gives up on the second call.
+	calls := 0
+	opts := mendoza.DefaultOptions.WithConvertFunc(func(value interface{}) interface{} {
+		if value, ok := value.(CustomObject); ok {
+			calls++
+			if calls > 1 {
+				return make(chan int)
+			}
+			return value.attrs
+		}
+		return value
+	})
+
+	custom := CustomObject{attrs: map[string]interface{}{"c": "d"}}
+	left := map[string]interface{}{"a": "b"}
+	right := map[string]interface{}{"a": "b", "b": []interface{}{custom}}
+
+	patch, err := opts.CreatePatch(left, right)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.EqualValues(t, map[string]interface{}{"a": "b", "b": []interface{}{custom.attrs}}, mendoza.ApplyPatch(left, patch))
+}
@@ -0,0 +1,445 @@
+package mendoza
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// traceKind describes how a value in the result of a patch was created.
+type traceKind int
+
+const (
+	// The value was copied unchanged from the base document (OpCopy, OpObjectCopyField, OpArrayAppendSlice
+	// or a field/element which was kept when its object/array was modified).
+	traceCopy traceKind = iota
+	// The value was written by the patch (OpValue, OpBlank or OpArrayAppendValue).
+	traceValue
+	// An object which was modified by the patch.
+	traceObject
+	// An array which was modified by the patch.
+	traceArray
+	// A string which was modified by the patch.
+	traceString
+)
+
+// traceNode describes a value in the result of a patch in terms of the base document. Values which
+// the patch doesn't modify are only described by the path they were copied from, so the size of the
+// tree depends on the patch (and the objects/arrays it modifies) and not on the size of the document.
+type traceNode struct {
+	kind traceKind
+	// base is the path in the base document of a copied value. For other values it's the path of the
+	// input value they were created from (with OpCopy or OpBlank), or nil if they were created from a
+	// value in the patch. The root is Path{}, so a nil path never refers to a value.
+	base Path
+	// value is the copied/written value, or the resulting string for traceString.
+	value interface{}
+	// fields contains the fields of a traceObject and items the elements of a traceArray.
+	fields map[string]*traceNode
+	items  []*traceNode
+}
+
+// result returns the value described by the node.
+func (n *traceNode) result() interface{} {
+	switch n.kind {
+	case traceObject:
+		obj := make(map[string]interface{}, len(n.fields))
+		for key, field := range n.fields {
+			obj[key] = field.result()
+		}
+		return obj
+	case traceArray:
+		arr := make([]interface{}, len(n.items))
+		for idx, item := range n.items {
+			arr[idx] = item.result()
+		}
+		return arr
+	}
+	return n.value
+}
+
+// isCopyOf returns true if the node is an unchanged copy of the value at the path in the base document.
+func (n *traceNode) isCopyOf(path Path) bool {
+	return n != nil && n.kind == traceCopy && equalPath(n.base, path)
+}
+
+// trace is the result of interpreting a patch against a base document.
+type trace struct {
+	// root is the base document (converted).
+	root interface{}
+	// result describes the document produced by the patch.
+	result *traceNode
+}
+
+type traceInput struct {
+	inputEntry
+	path Path
+}
+
+// tracer interprets a patch the same way as the patcher, but keeps track of where every value comes from
+// instead of building the result.
+type tracer struct {
+	options     *Options
+	inputStack  []traceInput
+	outputStack []*traceNode
+}
+
+// tracePatch interprets a patch against a base document. It fails with the same errors as TryApplyPatch
+// if the patch can't be applied to the document.
+func (options *Options) tracePatch(base interface{}, patch Patch) (*trace, error) {
+	root, err := mendoza.Convert(base, options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	t := tracer{
+		options:     options,
+		inputStack:  []traceInput{{inputEntry: inputEntry{value: root, parent: -1}, path: Path{}}},
+		outputStack: []*traceNode{{kind: traceCopy, base: Path{}, value: root}},
+	}
+
+	for idx, op := range patch {
+		err := t.step(op)
+		if applyErr, ok := err.(*ApplyError); ok {
+			applyErr.Index = idx
+			applyErr.Op = op
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &trace{root: root, result: t.outputStack[len(t.outputStack)-1]}, nil
+}
+
+func (t *tracer) input() *traceInput {
+	return &t.inputStack[len(t.inputStack)-1]
+}
+
+func (t *tracer) pushChild(key string, value interface{}, elem interface{}) error {
+	value, err := mendoza.Convert(value, t.options.convertFunc)
+	if err != nil {
+		return err
+	}
+	t.inputStack = append(t.inputStack, traceInput{
+		inputEntry: inputEntry{key: key, value: value},
+		path:       t.input().path.child(elem),
+	})
+	return nil
+}
+
+func (t *tracer) popInput() error {
+	if len(t.inputStack) < 2 {
+		return mismatch("pushed value on input stack", "only the root")
+	}
+	t.inputStack = t.inputStack[:len(t.inputStack)-1]
+	return nil
+}
+
+func (t *tracer) pushOutput(node *traceNode) {
+	t.outputStack = append(t.outputStack, node)
+}
+
+func (t *tracer) popOutput() (*traceNode, error) {
+	if len(t.outputStack) < 2 {
+		return nil, mismatch("pushed value on output stack", "only the root")
+	}
+	node := t.outputStack[len(t.outputStack)-1]
+	t.outputStack = t.outputStack[:len(t.outputStack)-1]
+	return node, nil
+}
+
+// outputObject turns the value on top of the output stack into a traceObject so that it can be modified.
+func (t *tracer) outputObject() (*traceNode, error) {
+	node := t.outputStack[len(t.outputStack)-1]
+	switch node.kind {
+	case traceObject:
+		return node, nil
+	case traceCopy, traceValue:
+		if node.value == nil {
+			node.kind = traceObject
+			node.fields = map[string]*traceNode{}
+			return node, nil
+		}
+		obj, ok := node.value.(map[string]interface{})
+		if !ok {
+			return nil, mismatch("object on output stack", describe(node.value))
+		}
+		node.fields = make(map[string]*traceNode, len(obj))
+		for key, value := range obj {
+			node.fields[key] = node.child(key, value)
+		}
+		node.kind = traceObject
+		node.value = nil
+		return node, nil
+	}
+	return nil, mismatch("object on output stack", describe(node.result()))
+}
+
+// outputArray turns the value on top of the output stack into a traceArray so that it can be modified.
+func (t *tracer) outputArray() (*traceNode, error) {
+	node := t.outputStack[len(t.outputStack)-1]
+	switch node.kind {
+	case traceArray:
+		return node, nil
+	case traceCopy, traceValue:
+		if node.value == nil {
+			node.kind = traceArray
+			return node, nil
+		}
+		arr, ok := node.value.([]interface{})
+		if !ok {
+			return nil, mismatch("array on output stack", describe(node.value))
+		}
+		node.items = make([]*traceNode, len(arr))
+		for idx, value := range arr {
+			node.items[idx] = node.child(idx, value)
+		}
+		node.kind = traceArray
+		node.value = nil
+		return node, nil
+	}
+	return nil, mismatch("array on output stack", describe(node.result()))
+}
+
+// outputString turns the value on top of the output stack into a traceString so that it can be modified.
+func (t *tracer) outputString() (*traceNode, error) {
+	node := t.outputStack[len(t.outputStack)-1]
+	switch node.kind {
+	case traceString:
+		return node, nil
+	case traceCopy, traceValue:
+		if node.value == nil {
+			node.kind = traceString
+			node.value = ""
+			return node, nil
+		}
+		if _, ok := node.value.(string); !ok {
+			return nil, mismatch("string on output stack", describe(node.value))
+		}
+		node.kind = traceString
+		return node, nil
+	}
+	return nil, mismatch("string on output stack", describe(node.result()))
+}
+
+// child returns the node of a field/element of a copied or written object/array.
+func (n *traceNode) child(elem interface{}, value interface{}) *traceNode {
+	if n.kind == traceCopy {
+		return &traceNode{kind: traceCopy, base: n.base.child(elem), value: value}
+	}
+	return &traceNode{kind: traceValue, value: value}
+}
+
+func (t *tracer) inputArray() ([]interface{}, error) {
+	value := t.input().value
+	arr, ok := value.([]interface{})
+	if !ok {
+		return nil, mismatch("array on input stack", describe(value))
+	}
+	return arr, nil
+}
+
+func (t *tracer) inputString() (string, error) {
+	value := t.input().value
+	str, ok := value.(string)
+	if !ok {
+		return "", mismatch("string on input stack", describe(value))
+	}
+	return str, nil
+}
+
+func (t *tracer) steps(ops ...Op) error {
+	for _, op := range ops {
+		if err := t.step(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tracer) step(op Op) error {
+	switch op := op.(type) {
+	case *OpValue:
+		t.pushOutput(&traceNode{kind: traceValue, value: op.Value})
+	case *OpCopy:
+		input := t.input()
+		t.pushOutput(&traceNode{kind: traceCopy, base: input.path, value: input.value})
+	case *OpBlank:
+		t.pushOutput(&traceNode{kind: traceValue, base: t.input().path})
+	case *OpReturnIntoObject:
+		return t.returnIntoObject(op.Key)
+	case *OpReturnIntoObjectSameKey:
+		return t.returnIntoObject(t.input().key)
+	case *OpReturnIntoArray:
+		node, err := t.popOutput()
+		if err != nil {
+			return err
+		}
+		arr, err := t.outputArray()
+		if err != nil {
+			return err
+		}
+		arr.items = append(arr.items, node)
+	case *OpPushField:
+		field, err := t.input().getField(op.Index)
+		if err != nil {
+			return err
+		}
+		return t.pushChild(field.key, field.value, field.key)
+	case *OpPushElement:
+		arr, err := t.inputArray()
+		if err != nil {
+			return err
+		}
+		if op.Index < 0 || op.Index >= len(arr) {
+			return mismatch(
+				fmt.Sprintf("element index %d on input stack", op.Index),
+				fmt.Sprintf("array with %d elements", len(arr)),
+			)
+		}
+		return t.pushChild("", arr[op.Index], op.Index)
+	case *OpPushParent:
+		idx := len(t.inputStack) - 2 - op.N
+		if op.N < 0 || idx < 0 {
+			return mismatch(
+				fmt.Sprintf("parent %d on input stack", op.N),
+				fmt.Sprintf("input stack of depth %d", len(t.inputStack)),
+			)
+		}
+		t.inputStack = append(t.inputStack, t.inputStack[idx])
+	case *OpPop:
+		return t.popInput()
+	case *OpPushFieldCopy:
+		return t.steps(&op.OpPushField, &op.OpCopy)
+	case *OpPushFieldBlank:
+		return t.steps(&op.OpPushField, &op.OpBlank)
+	case *OpPushElementCopy:
+		return t.steps(&op.OpPushElement, &op.OpCopy)
+	case *OpPushElementBlank:
+		return t.steps(&op.OpPushElement, &op.OpBlank)
+	case *OpReturnIntoObjectPop:
+		return t.steps(&op.OpReturnIntoObject, &op.OpPop)
+	case *OpReturnIntoObjectSameKeyPop:
+		return t.steps(&op.OpReturnIntoObjectSameKey, &op.OpPop)
+	case *OpReturnIntoArrayPop:
+		return t.steps(&op.OpReturnIntoArray, &op.OpPop)
+	case *OpObjectSetFieldValue:
+		return t.steps(&op.OpValue, &op.OpReturnIntoObject)
+	case *OpObjectCopyField:
+		return t.steps(&op.OpPushField, &op.OpCopy, &op.OpReturnIntoObjectSameKey, &op.OpPop)
+	case *OpObjectDeleteField:
+		field, err := t.input().getField(op.Index)
+		if err != nil {
+			return err
+		}
+		obj, err := t.outputObject()
+		if err != nil {
+			return err
+		}
+		delete(obj.fields, field.key)
+	case *OpArrayAppendValue:
+		arr, err := t.outputArray()
+		if err != nil {
+			return err
+		}
+		arr.items = append(arr.items, &traceNode{kind: traceValue, value: op.Value})
+	case *OpArrayAppendSlice:
+		src, err := t.inputArray()
+		if err != nil {
+			return err
+		}
+		if err := checkSlice(op.Left, op.Right, len(src)); err != nil {
+			return err
+		}
+		arr, err := t.outputArray()
+		if err != nil {
+			return err
+		}
+		path := t.input().path
+		for idx := op.Left; idx < op.Right; idx++ {
+			arr.items = append(arr.items, &traceNode{kind: traceCopy, base: path.child(idx), value: src[idx]})
+		}
+	case *OpStringAppendString:
+		str, err := t.outputString()
+		if err != nil {
+			return err
+		}
+		str.value = str.value.(string) + op.String
+	case *OpStringAppendSlice:
+		src, err := t.inputString()
+		if err != nil {
+			return err
+		}
+		if err := checkSlice(op.Left, op.Right, len(src)); err != nil {
+			return err
+		}
+		str, err := t.outputString()
+		if err != nil {
+			return err
+		}
+		str.value = str.value.(string) + src[op.Left:op.Right]
+	case *OpAssertFingerprint:
+		hashList, err := mendoza.HashListFor(t.input().value, t.options.convertFunc)
+		if err != nil {
+			return err
+		}
+		if Fingerprint(hashList.Entries[0].Hash) != op.Fingerprint {
+			return ErrBaseMismatch
+		}
+	default:
+		return fmt.Errorf("mendoza: unknown operation %T", op)
+	}
+	return nil
+}
+
+func (t *tracer) returnIntoObject(key string) error {
+	node, err := t.popOutput()
+	if err != nil {
+		return err
+	}
+	obj, err := t.outputObject()
+	if err != nil {
+		return err
+	}
+	obj.fields[key] = node
+	return nil
+}
+
+// equalPath returns true if two paths are equal. A nil path is only equal to another nil path.
+func equalPath(a, b Path) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// childIndex returns the index of an element if path refers to an element of the array at parent.
+func childIndex(path, parent Path) (int, bool) {
+	if path == nil || len(path) != len(parent)+1 || !equalPath(path[:len(parent)], parent) {
+		return 0, false
+	}
+	idx, ok := path[len(parent)].(int)
+	return idx, ok
+}
+
+// sortedFieldKeys returns the keys of the fields of a traceObject and the keys of the base object in sorted order.
+func sortedFieldKeys(fields map[string]*traceNode, base map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields)+len(base))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	for key := range base {
+		if _, ok := fields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
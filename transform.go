@@ -0,0 +1,476 @@
+package mendoza
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sanity-io/mendoza/internal/mendoza"
+)
+
+// Transform rewrites a patch so that it can be applied on top of a concurrent patch: Both ours and
+// theirs were created against base, and the returned patch applies to ApplyPatch(base, theirs).
+// The result contains the changes from both patches (see Merge). Conflicting changes are resolved
+// in favor of ours: If both patches changed the same part of an array (e.g. one of them reordered it
+// while the other modified an element), that part of the array is taken from ours.
+//
+// The operations of ours are rebased onto theirs: Values which ours copies from base are copied from
+// where theirs placed them (with the field and element indices remapped), and values which theirs
+// already produced are kept as they are. The size of the result depends on the patches and not on
+// the size of the document.
+//
+// This function uses the default options.
+func Transform(base interface{}, ours, theirs Patch) (Patch, error) {
+	return DefaultOptions.Transform(base, ours, theirs)
+}
+
+// Transform rewrites a patch so that it can be applied on top of a concurrent patch: Both ours and
+// theirs were created against base, and the returned patch applies to ApplyPatch(base, theirs).
+// Conflicting changes are resolved in favor of ours.
+//
+// If either patch can't be applied it returns the error from TryApplyPatch.
+func (options *Options) Transform(base interface{}, ours, theirs Patch) (Patch, error) {
+	m, merged, err := options.mergePatches(base, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if merged.kind == mergedB {
+		// Theirs already contains all of our changes.
+		return Patch{}, nil
+	}
+
+	root, err := mendoza.Convert(m.b.result.result(), options.convertFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	r := rebaser{
+		options: options,
+		theirs:  m.b.result,
+		input:   []rebaseInput{{path: Path{}, value: root}},
+		patch:   Patch{},
+	}
+
+	if merged.kind == mergedObject {
+		// The root output is the document produced by theirs, so it can be modified directly.
+		err = r.modifyObject(merged)
+	} else {
+		err = r.emitValue(merged)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.patch, nil
+}
+
+// rebaseInput is a value on the input stack of the patch being created. The input is always
+// the document produced by theirs.
+type rebaseInput struct {
+	path  Path
+	value interface{}
+	// keys are the sorted keys of an object (computed when they're first needed).
+	keys []string
+}
+
+// rebaser creates a patch against the document produced by theirs from the result of a merge.
+type rebaser struct {
+	options *Options
+	theirs  *traceNode
+	input   []rebaseInput
+	patch   Patch
+	// copies maps a path in the base document to the path where theirs copied it to.
+	copies map[string]Path
+}
+
+func (r *rebaser) add(op Op) {
+	r.patch = append(r.patch, op)
+}
+
+func (r *rebaser) top() *rebaseInput {
+	return &r.input[len(r.input)-1]
+}
+
+// keys returns the sorted keys of the object on top of the input stack.
+func (r *rebaser) keys() []string {
+	top := r.top()
+	if top.keys == nil {
+		obj, _ := top.value.(map[string]interface{})
+		top.keys = make([]string, 0, len(obj))
+		for key := range obj {
+			top.keys = append(top.keys, key)
+		}
+		sort.Strings(top.keys)
+	}
+	return top.keys
+}
+
+// fieldIndex returns the index of a key in the object on top of the input stack.
+func (r *rebaser) fieldIndex(key string) (int, bool) {
+	keys := r.keys()
+	idx := sort.SearchStrings(keys, key)
+	return idx, idx < len(keys) && keys[idx] == key
+}
+
+// pushChild pushes a field/element of the value on top of the input stack.
+func (r *rebaser) pushChild(elem interface{}) error {
+	switch elem := elem.(type) {
+	case string:
+		idx, ok := r.fieldIndex(elem)
+		if !ok {
+			return fmt.Errorf("mendoza: field %q doesn't exist at %s", elem, r.top().path)
+		}
+		r.add(&OpPushField{Index: idx})
+	case int:
+		arr, _ := r.top().value.([]interface{})
+		if elem >= len(arr) {
+			return fmt.Errorf("mendoza: element %d doesn't exist at %s", elem, r.top().path)
+		}
+		r.add(&OpPushElement{Index: elem})
+	}
+	return r.pushInput(elem)
+}
+
+// pushInput keeps track of a field/element which the patch pushed onto the input stack.
+func (r *rebaser) pushInput(elem interface{}) error {
+	top := r.top()
+	var value interface{}
+	switch elem := elem.(type) {
+	case string:
+		value = top.value.(map[string]interface{})[elem]
+	case int:
+		value = top.value.([]interface{})[elem]
+	}
+
+	value, err := mendoza.Convert(value, r.options.convertFunc)
+	if err != nil {
+		return err
+	}
+	r.input = append(r.input, rebaseInput{path: top.path.child(elem), value: value})
+	return nil
+}
+
+// navigate pushes the value at a path onto the input stack, starting from the closest value
+// which is already on the stack. It returns the number of values which were pushed.
+func (r *rebaser) navigate(path Path) (int, error) {
+	best := 0
+	for idx := len(r.input) - 1; idx > 0; idx-- {
+		if isPrefix(r.input[idx].path, path) {
+			best = idx
+			break
+		}
+	}
+
+	pushed := 0
+	if best != len(r.input)-1 {
+		r.add(&OpPushParent{N: len(r.input) - 2 - best})
+		r.input = append(r.input, rebaseInput{path: r.input[best].path, value: r.input[best].value, keys: r.input[best].keys})
+		pushed++
+	}
+
+	for _, elem := range path[len(r.input[best].path):] {
+		err := r.pushChild(elem)
+		if err != nil {
+			return 0, err
+		}
+		pushed++
+	}
+
+	return pushed, nil
+}
+
+func (r *rebaser) pop(n int) {
+	for i := 0; i < n; i++ {
+		r.add(&OpPop{})
+	}
+	r.input = r.input[:len(r.input)-n]
+}
+
+// inPlace returns true if a merged value is modified starting from the value in theirs.
+func inPlace(n *mergedNode) bool {
+	return n.kind == mergedObject || (n.kind == mergedArray && len(n.items) > 0)
+}
+
+// modifyObject modifies the object on top of the output stack (a copy of the object on top of the
+// input stack) so that it becomes the merged object.
+func (r *rebaser) modifyObject(n *mergedNode) error {
+	for idx, key := range r.keys() {
+		if _, ok := n.fields[key]; !ok {
+			r.add(&OpObjectDeleteField{Index: idx})
+		}
+	}
+
+	keys := make([]string, 0, len(n.fields))
+	for key := range n.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := n.fields[key]
+		idx, exists := r.fieldIndex(key)
+		switch {
+		case field.kind == mergedB && exists && equalPath(field.theirs, n.theirs.child(key)):
+			// The field is already there.
+		case inPlace(field) && exists && equalPath(field.theirs, n.theirs.child(key)):
+			err := r.emitChild(key, idx, field, &OpReturnIntoObjectSameKeyPop{})
+			if err != nil {
+				return err
+			}
+		default:
+			err := r.emitValue(field)
+			if err != nil {
+				return err
+			}
+			if value, ok := r.patch[len(r.patch)-1].(*OpValue); ok {
+				r.patch[len(r.patch)-1] = &OpObjectSetFieldValue{OpValue: *value, OpReturnIntoObject: OpReturnIntoObject{Key: key}}
+			} else {
+				r.add(&OpReturnIntoObject{Key: key})
+			}
+		}
+	}
+
+	return nil
+}
+
+// emitChild pushes a field/element of the input, creates the merged value from it and returns
+// the value into the parent with ret (which also pops the field/element).
+func (r *rebaser) emitChild(elem interface{}, idx int, n *mergedNode, ret Op) error {
+	if n.kind == mergedObject {
+		if _, ok := elem.(string); ok {
+			r.add(&OpPushFieldCopy{OpPushField: OpPushField{Index: idx}})
+		} else {
+			r.add(&OpPushElementCopy{OpPushElement: OpPushElement{Index: idx}})
+		}
+	} else {
+		if _, ok := elem.(string); ok {
+			r.add(&OpPushFieldBlank{OpPushField: OpPushField{Index: idx}})
+		} else {
+			r.add(&OpPushElementBlank{OpPushElement: OpPushElement{Index: idx}})
+		}
+	}
+
+	err := r.pushInput(elem)
+	if err != nil {
+		return err
+	}
+
+	if n.kind == mergedObject {
+		err = r.modifyObject(n)
+	} else {
+		err = r.buildArray(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.add(ret)
+	r.input = r.input[:len(r.input)-1]
+	return nil
+}
+
+// buildArray appends the elements of the merged array to the (blank) array on top of the output stack.
+// The input is the array in theirs.
+func (r *rebaser) buildArray(n *mergedNode) error {
+	length := len(r.top().value.([]interface{}))
+
+	for idx := 0; idx < len(n.items); {
+		item := n.items[idx]
+		elemIdx, isChild := childIndex(item.theirs, n.theirs)
+		isChild = isChild && elemIdx < length && item.kind != mergedA
+
+		switch {
+		case isChild && item.kind == mergedB:
+			// Copy every following element which is also kept from theirs.
+			end := idx + 1
+			for end < len(n.items) && n.items[end].kind == mergedB && equalPath(n.items[end].theirs, n.theirs.child(elemIdx+end-idx)) {
+				end++
+			}
+			r.add(&OpArrayAppendSlice{Left: elemIdx, Right: elemIdx + end - idx})
+			idx = end
+			continue
+		case isChild && inPlace(item):
+			err := r.emitChild(elemIdx, elemIdx, item, &OpReturnIntoArrayPop{})
+			if err != nil {
+				return err
+			}
+		default:
+			err := r.emitValue(item)
+			if err != nil {
+				return err
+			}
+			r.add(&OpReturnIntoArray{})
+		}
+		idx++
+	}
+
+	return nil
+}
+
+// emitValue pushes a merged value onto the output stack.
+func (r *rebaser) emitValue(n *mergedNode) error {
+	switch {
+	case n.kind == mergedA:
+		return r.emitTrace(n.node)
+	case n.kind == mergedArray && len(n.items) == 0:
+		r.add(&OpValue{Value: []interface{}{}})
+		return nil
+	}
+
+	pushed, err := r.navigate(n.theirs)
+	if err != nil {
+		return err
+	}
+
+	switch n.kind {
+	case mergedB:
+		r.add(&OpCopy{})
+	case mergedObject:
+		r.add(&OpCopy{})
+		err = r.modifyObject(n)
+	case mergedArray:
+		r.add(&OpBlank{})
+		err = r.buildArray(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.pop(pushed)
+	return nil
+}
+
+// emitTrace pushes a value from ours onto the output stack. Values which ours copied from base are copied
+// from theirs if theirs kept them unchanged.
+func (r *rebaser) emitTrace(node *traceNode) error {
+	switch node.kind {
+	case traceCopy:
+		if path, ok := r.locate(node.base); ok {
+			pushed, err := r.navigate(path)
+			if err != nil {
+				return err
+			}
+			r.add(&OpCopy{})
+			r.pop(pushed)
+			return nil
+		}
+	case traceObject:
+		if len(node.fields) == 0 {
+			r.add(&OpValue{Value: map[string]interface{}{}})
+			return nil
+		}
+		r.add(&OpBlank{})
+		keys := make([]string, 0, len(node.fields))
+		for key := range node.fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err := r.emitTrace(node.fields[key])
+			if err != nil {
+				return err
+			}
+			r.add(&OpReturnIntoObject{Key: key})
+		}
+		return nil
+	case traceArray:
+		if len(node.items) == 0 {
+			r.add(&OpValue{Value: []interface{}{}})
+			return nil
+		}
+		r.add(&OpBlank{})
+		return r.emitTraceItems(node.items)
+	}
+
+	value, err := mendoza.ConvertDeep(node.result(), r.options.convertFunc)
+	if err != nil {
+		return err
+	}
+	r.add(&OpValue{Value: value})
+	return nil
+}
+
+// emitTraceItems appends elements from ours to the array on top of the output stack. Consecutive
+// elements which are found next to each other in theirs are appended as a single slice.
+func (r *rebaser) emitTraceItems(items []*traceNode) error {
+	for idx := 0; idx < len(items); {
+		var path Path
+		found := false
+		if items[idx].kind == traceCopy {
+			path, found = r.locate(items[idx].base)
+		}
+
+		if found && len(path) > 0 {
+			if start, ok := path[len(path)-1].(int); ok {
+				parent := path[:len(path)-1]
+				end := idx + 1
+				for end < len(items) && items[end].kind == traceCopy {
+					next, ok := r.locate(items[end].base)
+					if !ok || !equalPath(next, parent.child(start+end-idx)) {
+						break
+					}
+					end++
+				}
+
+				pushed, err := r.navigate(parent)
+				if err != nil {
+					return err
+				}
+				r.add(&OpArrayAppendSlice{Left: start, Right: start + end - idx})
+				r.pop(pushed)
+				idx = end
+				continue
+			}
+		}
+
+		err := r.emitTrace(items[idx])
+		if err != nil {
+			return err
+		}
+		r.add(&OpReturnIntoArray{})
+		idx++
+	}
+	return nil
+}
+
+// locate returns the path in the document produced by theirs which contains the value at a path in
+// the base document, if theirs kept it unchanged.
+func (r *rebaser) locate(path Path) (Path, bool) {
+	if r.copies == nil {
+		r.copies = map[string]Path{}
+		r.indexCopies(r.theirs, Path{})
+	}
+
+	for depth := len(path); depth >= 0; depth-- {
+		if at, ok := r.copies[path[:depth].String()]; ok {
+			result := make(Path, 0, len(at)+len(path)-depth)
+			result = append(result, at...)
+			return append(result, path[depth:]...), true
+		}
+	}
+	return nil, false
+}
+
+// indexCopies records every value which theirs copied from the base document.
+func (r *rebaser) indexCopies(node *traceNode, at Path) {
+	switch node.kind {
+	case traceCopy:
+		key := node.base.String()
+		if _, ok := r.copies[key]; !ok {
+			r.copies[key] = at
+		}
+	case traceObject:
+		for _, key := range sortedFieldKeys(node.fields, nil) {
+			r.indexCopies(node.fields[key], at.child(key))
+		}
+	case traceArray:
+		for idx, item := range node.items {
+			r.indexCopies(item, at.child(idx))
+		}
+	}
+}
+
+// isPrefix returns true if path starts with prefix.
+func isPrefix(prefix, path Path) bool {
+	return len(prefix) <= len(path) && equalPath(prefix, path[:len(prefix)])
+}
@@ -0,0 +1,163 @@
+package mendoza_test
+
+import (
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransform(t *testing.T) {
+	base := map[string]interface{}{
+		"name":   "Michael Bluth",
+		"skills": []interface{}{"business", "banana stand"},
+	}
+	oursDoc := map[string]interface{}{
+		"name":   "Michael",
+		"skills": []interface{}{"business", "banana stand"},
+	}
+	theirsDoc := map[string]interface{}{
+		"age":    35.0,
+		"name":   "Michael Bluth",
+		"skills": []interface{}{"business", "banana stand", "dancing"},
+	}
+
+	ours, err := mendoza.CreatePatch(base, oursDoc)
+	require.NoError(t, err)
+	theirs, err := mendoza.CreatePatch(base, theirsDoc)
+	require.NoError(t, err)
+
+	transformed, err := mendoza.Transform(base, ours, theirs)
+	require.NoError(t, err)
+
+	expected := map[string]interface{}{
+		"age":    35.0,
+		"name":   "Michael",
+		"skills": []interface{}{"business", "banana stand", "dancing"},
+	}
+	require.Equal(t, expected, mendoza.ApplyPatch(theirsDoc, transformed))
+
+	t.Run("Conflict", func(t *testing.T) {
+		theirsDoc := map[string]interface{}{
+			"name":   "Mike",
+			"skills": []interface{}{"business", "banana stand"},
+		}
+		theirs, err := mendoza.CreatePatch(base, theirsDoc)
+		require.NoError(t, err)
+
+		transformed, err := mendoza.Transform(base, ours, theirs)
+		require.NoError(t, err)
+		require.Equal(t, oursDoc, mendoza.ApplyPatch(theirsDoc, transformed))
+	})
+
+	t.Run("ReorderModify", func(t *testing.T) {
+		base := map[string]interface{}{
+			"l": []interface{}{
+				map[string]interface{}{"k": "a"},
+				map[string]interface{}{"k": "b"},
+				map[string]interface{}{"k": "c"},
+			},
+		}
+		reversed := map[string]interface{}{
+			"l": []interface{}{
+				map[string]interface{}{"k": "c"},
+				map[string]interface{}{"k": "b"},
+				map[string]interface{}{"k": "a"},
+			},
+		}
+		modified := map[string]interface{}{
+			"l": []interface{}{
+				map[string]interface{}{"k": "a", "z": 1.0},
+				map[string]interface{}{"k": "b"},
+				map[string]interface{}{"k": "c"},
+			},
+		}
+
+		reversePatch, err := mendoza.CreatePatch(base, reversed)
+		require.NoError(t, err)
+		modifyPatch, err := mendoza.CreatePatch(base, modified)
+		require.NoError(t, err)
+
+		// The changes conflict, so our array is used and the modification is never moved to another element.
+		transformed, err := mendoza.Transform(base, reversePatch, modifyPatch)
+		require.NoError(t, err)
+		require.Equal(t, reversed, mendoza.ApplyPatch(modified, transformed))
+
+		transformed, err = mendoza.Transform(base, modifyPatch, reversePatch)
+		require.NoError(t, err)
+		require.Equal(t, modified, mendoza.ApplyPatch(reversed, transformed))
+	})
+
+	t.Run("Rebased", func(t *testing.T) {
+		// Ours copies "banana stand" into a new field.
+		ours := mendoza.Patch{
+			&mendoza.OpPushField{Index: 1},
+			&mendoza.OpPushElement{Index: 1},
+			&mendoza.OpCopy{},
+			&mendoza.OpPop{},
+			&mendoza.OpPop{},
+			&mendoza.OpReturnIntoObject{Key: "favorite"},
+		}
+		// Theirs inserts an element before it.
+		theirs := mendoza.Patch{
+			&mendoza.OpPushFieldBlank{OpPushField: mendoza.OpPushField{Index: 1}},
+			&mendoza.OpArrayAppendValue{Value: "dancing"},
+			&mendoza.OpArrayAppendSlice{Left: 0, Right: 2},
+			&mendoza.OpReturnIntoObjectSameKeyPop{},
+		}
+		theirsDoc := mendoza.ApplyPatch(base, theirs)
+
+		transformed, err := mendoza.Transform(base, ours, theirs)
+		require.NoError(t, err)
+		require.Equal(t, mendoza.Patch{
+			&mendoza.OpPushField{Index: 1},
+			&mendoza.OpPushElement{Index: 2},
+			&mendoza.OpCopy{},
+			&mendoza.OpPop{},
+			&mendoza.OpPop{},
+			&mendoza.OpReturnIntoObject{Key: "favorite"},
+		}, transformed)
+		require.Equal(t, map[string]interface{}{
+			"name":     "Michael Bluth",
+			"skills":   []interface{}{"dancing", "business", "banana stand"},
+			"favorite": "banana stand",
+		}, mendoza.ApplyPatch(theirsDoc, transformed))
+	})
+
+	t.Run("Untouched", func(t *testing.T) {
+		items := make([]interface{}, 10000)
+		for idx := range items {
+			items[idx] = float64(idx)
+		}
+		base := map[string]interface{}{
+			"name":  "Michael Bluth",
+			"items": items,
+		}
+
+		ours := mendoza.Patch{
+			&mendoza.OpObjectSetFieldValue{
+				OpValue:            mendoza.OpValue{Value: "Michael"},
+				OpReturnIntoObject: mendoza.OpReturnIntoObject{Key: "name"},
+			},
+		}
+		theirs := mendoza.Patch{
+			&mendoza.OpPushFieldCopy{OpPushField: mendoza.OpPushField{Index: 0}},
+			&mendoza.OpArrayAppendValue{Value: 10000.0},
+			&mendoza.OpReturnIntoObjectSameKeyPop{},
+		}
+
+		// Only our own change is included, regardless of the size of the document.
+		transformed, err := mendoza.Transform(base, ours, theirs)
+		require.NoError(t, err)
+		require.Equal(t, ours, transformed)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		opts := mendoza.DefaultOptions.WithBaseFingerprint(true)
+		ours, err := opts.CreatePatch(base, oursDoc)
+		require.NoError(t, err)
+
+		_, err = opts.Transform(theirsDoc, ours, theirs)
+		require.Equal(t, mendoza.ErrBaseMismatch, err)
+	})
+}
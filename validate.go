@@ -0,0 +1,169 @@
+package mendoza
+
+import "fmt"
+
+// ValidationError describes the first structural problem found by Validate.
+type ValidationError struct {
+	// Index is the position of the offending operation in the patch. If the problem is
+	// detected after the last operation this is equal to the length of the patch.
+	Index int
+	// Op is the offending operation, or nil if the problem is detected at the end of the patch.
+	Op Op
+	// Reason describes the problem.
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	if err.Op == nil {
+		return fmt.Sprintf("mendoza: invalid patch at end: %s", err.Reason)
+	}
+	return fmt.Sprintf("mendoza: invalid op %d (%T): %s", err.Index, err.Op, err.Reason)
+}
+
+// Validate checks that a patch is well-formed without looking at any document.
+//
+// It simulates the depth of the input and output stacks and verifies that every
+// pop/return has a matching push, that PushParent never looks beyond the input stack,
+// that slices are not reversed, and that the output stack ends with a single result
+// (either the root itself or one value pushed on top of it).
+//
+// A valid patch can still fail to apply if it's used against the wrong document.
+func Validate(patch Patch) error {
+	v := validator{input: 1, output: 1}
+
+	for idx, op := range patch {
+		reason := v.step(op)
+		if reason != "" {
+			return &ValidationError{Index: idx, Op: op, Reason: reason}
+		}
+	}
+
+	if v.output > 2 {
+		return &ValidationError{
+			Index:  len(patch),
+			Reason: fmt.Sprintf("%d values left on output stack", v.output-1),
+		}
+	}
+
+	return nil
+}
+
+// validator keeps track of the depth of the input/output stacks.
+type validator struct {
+	input  int
+	output int
+}
+
+func (v *validator) pushInput() string {
+	v.input++
+	return ""
+}
+
+func (v *validator) pushParent(n int) string {
+	if n < 0 || v.input-2-n < 0 {
+		return fmt.Sprintf("parent %d is outside of input stack of depth %d", n, v.input)
+	}
+	v.input++
+	return ""
+}
+
+func (v *validator) popInput() string {
+	if v.input < 2 {
+		return "pop without matching push on input stack"
+	}
+	v.input--
+	return ""
+}
+
+func (v *validator) pushOutput() string {
+	v.output++
+	return ""
+}
+
+func (v *validator) returnOutput() string {
+	if v.output < 2 {
+		return "return without matching push on output stack"
+	}
+	v.output--
+	return ""
+}
+
+func (v *validator) index(idx int) string {
+	if idx < 0 {
+		return fmt.Sprintf("negative index %d", idx)
+	}
+	return ""
+}
+
+func (v *validator) slice(left, right int) string {
+	if left < 0 || left > right {
+		return fmt.Sprintf("invalid slice [%d:%d]", left, right)
+	}
+	return ""
+}
+
+func (v *validator) all(steps ...func() string) string {
+	for _, step := range steps {
+		if reason := step(); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func (v *validator) step(op Op) string {
+	switch op := op.(type) {
+	case *OpValue:
+		return v.pushOutput()
+	case *OpCopy:
+		return v.pushOutput()
+	case *OpBlank:
+		return v.pushOutput()
+	case *OpReturnIntoArray:
+		return v.returnOutput()
+	case *OpReturnIntoObject:
+		return v.returnOutput()
+	case *OpReturnIntoObjectSameKey:
+		return v.returnOutput()
+	case *OpPushField:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput)
+	case *OpPushElement:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput)
+	case *OpPushParent:
+		return v.pushParent(op.N)
+	case *OpPop:
+		return v.popInput()
+	case *OpPushFieldCopy:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput, v.pushOutput)
+	case *OpPushFieldBlank:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput, v.pushOutput)
+	case *OpPushElementCopy:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput, v.pushOutput)
+	case *OpPushElementBlank:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput, v.pushOutput)
+	case *OpReturnIntoObjectPop:
+		return v.all(v.returnOutput, v.popInput)
+	case *OpReturnIntoObjectSameKeyPop:
+		return v.all(v.returnOutput, v.popInput)
+	case *OpReturnIntoArrayPop:
+		return v.all(v.returnOutput, v.popInput)
+	case *OpObjectSetFieldValue:
+		return v.all(v.pushOutput, v.returnOutput)
+	case *OpObjectCopyField:
+		return v.all(func() string { return v.index(op.Index) }, v.pushInput, v.pushOutput, v.returnOutput, v.popInput)
+	case *OpObjectDeleteField:
+		return v.index(op.Index)
+	case *OpArrayAppendValue:
+		return ""
+	case *OpArrayAppendSlice:
+		return v.slice(op.Left, op.Right)
+	case *OpStringAppendString:
+		return ""
+	case *OpStringAppendSlice:
+		return v.slice(op.Left, op.Right)
+	case *OpAssertFingerprint:
+		return ""
+	default:
+		return fmt.Sprintf("unknown operation %T", op)
+	}
+}
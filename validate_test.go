@@ -0,0 +1,40 @@
+package mendoza_test
+
+import (
+	"testing"
+
+	"github.com/sanity-io/mendoza"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	invalid := []struct {
+		Patch mendoza.Patch
+		Index int
+	}{
+		{mendoza.Patch{&mendoza.OpPop{}}, 0},
+		{mendoza.Patch{&mendoza.OpReturnIntoArray{}}, 0},
+		{mendoza.Patch{&mendoza.OpPushField{Index: 0}, &mendoza.OpPushParent{N: 1}}, 1},
+		{mendoza.Patch{&mendoza.OpBlank{}, &mendoza.OpArrayAppendSlice{Left: 2, Right: 1}}, 1},
+		{mendoza.Patch{&mendoza.OpBlank{}, &mendoza.OpStringAppendSlice{Left: -1, Right: 1}}, 1},
+		{mendoza.Patch{&mendoza.OpReturnIntoObjectSameKeyPop{}}, 0},
+		{mendoza.Patch{&mendoza.OpBlank{}, &mendoza.OpBlank{}}, 2},
+	}
+
+	for _, c := range invalid {
+		err := mendoza.Validate(c.Patch)
+		require.Error(t, err)
+		require.Equal(t, c.Index, err.(*mendoza.ValidationError).Index)
+	}
+
+	valid := []mendoza.Patch{
+		{},
+		{&mendoza.OpValue{Value: "abc"}},
+		{&mendoza.OpPushField{Index: 0}, &mendoza.OpPushParent{N: 0}, &mendoza.OpPop{}, &mendoza.OpPop{}},
+		{&mendoza.OpPushFieldBlank{OpPushField: mendoza.OpPushField{Index: 1}}, &mendoza.OpArrayAppendSlice{Left: 0, Right: 0}, &mendoza.OpReturnIntoObjectSameKeyPop{}},
+	}
+
+	for _, patch := range valid {
+		require.NoError(t, mendoza.Validate(patch))
+	}
+}